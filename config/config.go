@@ -1,44 +1,145 @@
 package config
 
 import (
+	"crypto/x509"
 	"log"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/antfie/FoxBot/types"
 	"github.com/antfie/FoxBot/utils"
 	"gopkg.in/yaml.v3"
 )
 
+const (
+	// Small enough for a Pi Zero, most feeds are waiting on the network rather than the CPU
+	defaultConcurrencyWorkers = 8
+	defaultConcurrencyPerHost = 2
+)
+
+type yamlRoute struct {
+	Tasks      []string `yaml:"tasks"`
+	Groups     []string `yaml:"groups"`
+	Severities []string `yaml:"severities"`
+}
+
+type yamlTimeWindow struct {
+	From string   `yaml:"from"`
+	To   string   `yaml:"to"`
+	Days []string `yaml:"days"`
+}
+
+// yamlTimeWindows is inlined wherever from/to can be set, more windows can be listed under windows
+type yamlTimeWindows struct {
+	yamlTimeWindow `yaml:",inline"`
+	Windows        []yamlTimeWindow `yaml:"windows"`
+	Timezone       string           `yaml:"timezone"`
+}
+
 type yamlTimeCheck struct {
-	Frequency string `yaml:"frequency"`
-	From      string `yaml:"from"`
-	To        string `yaml:"to"`
+	Frequency       string `yaml:"frequency"`
+	Jitter          string `yaml:"jitter"`
+	Timeout         string `yaml:"timeout"`
+	yamlTimeWindows `yaml:",inline"`
 }
 
 type yamlConfig struct {
 	CheckForNewVersions bool   `yaml:"check_for_new_versions"`
 	DBPath              string `yaml:"db_path"`
 	LogPath             string `yaml:"log_path"`
-	Output              struct {
+	Concurrency         struct {
+		Workers int `yaml:"workers"`
+		PerHost int `yaml:"per_host"`
+	} `yaml:"concurrency"`
+	Http struct {
+		Proxy           string `yaml:"proxy"`
+		CABundle        string `yaml:"ca_bundle"`
+		UserAgent       string `yaml:"user_agent"`
+		Timeout         string `yaml:"timeout"`
+		Retries         *int   `yaml:"retries"`
+		RetryDelay      string `yaml:"retry_delay"`
+		MaxRetryDelay   string `yaml:"max_retry_delay"`
+		MaxResponseSize string `yaml:"max_response_size"`
+		Hosts           map[string]struct {
+			UserAgent string            `yaml:"user_agent"`
+			Headers   map[string]string `yaml:"headers"`
+			Cookies   map[string]string `yaml:"cookies"`
+			Username  string            `yaml:"username"`
+			Password  string            `yaml:"password"`
+		} `yaml:"hosts"`
+	} `yaml:"http"`
+	Output struct {
 		Console bool `yaml:"console"`
 		Slack   *struct {
-			Token     string `yaml:"token"`
-			ChannelId string `yaml:"channel_id"`
-			From      string `yaml:"from"`
-			To        string `yaml:"to"`
+			Token           string `yaml:"token"`
+			ChannelId       string `yaml:"channel_id"`
+			SigningSecret   string `yaml:"signing_secret"`
+			ListenAddress   string `yaml:"listen_address"`
+			yamlTimeWindows `yaml:",inline"`
+			Routes          []yamlRoute `yaml:"routes"`
 		} `yaml:"slack"`
 		Telegram *struct {
-			Token  string `yaml:"token"`
-			ChatID string `yaml:"chat_id"`
-			From   string `yaml:"from"`
-			To     string `yaml:"to"`
+			Token           string `yaml:"token"`
+			ChatID          string `yaml:"chat_id"`
+			yamlTimeWindows `yaml:",inline"`
+			Routes          []yamlRoute `yaml:"routes"`
 		} `yaml:"telegram"`
 		Discord *struct {
-			WebhookURL string `yaml:"webhook_url"`
-			From       string `yaml:"from"`
-			To         string `yaml:"to"`
+			WebhookURL      string `yaml:"webhook_url"`
+			Token           string `yaml:"token"`
+			ChannelID       string `yaml:"channel_id"`
+			yamlTimeWindows `yaml:",inline"`
+			Routes          []yamlRoute `yaml:"routes"`
 		} `yaml:"discord"`
+		Matrix *struct {
+			Homeserver      string `yaml:"homeserver"`
+			AccessToken     string `yaml:"access_token"`
+			RoomID          string `yaml:"room_id"`
+			yamlTimeWindows `yaml:",inline"`
+			Routes          []yamlRoute `yaml:"routes"`
+		} `yaml:"matrix"`
+		Ntfy *struct {
+			Server          string `yaml:"server"`
+			Topic           string `yaml:"topic"`
+			Token           string `yaml:"token"`
+			yamlTimeWindows `yaml:",inline"`
+			Routes          []yamlRoute `yaml:"routes"`
+		} `yaml:"ntfy"`
+		Gotify *struct {
+			Server          string `yaml:"server"`
+			Token           string `yaml:"token"`
+			yamlTimeWindows `yaml:",inline"`
+			Routes          []yamlRoute `yaml:"routes"`
+		} `yaml:"gotify"`
+		Email *struct {
+			Host            string   `yaml:"host"`
+			Port            int      `yaml:"port"`
+			Security        string   `yaml:"security"`
+			Username        string   `yaml:"username"`
+			Password        string   `yaml:"password"`
+			Sender          string   `yaml:"sender"`
+			Recipients      []string `yaml:"recipients"`
+			Subject         string   `yaml:"subject"`
+			Digest          string   `yaml:"digest"`
+			yamlTimeWindows `yaml:",inline"`
+			Routes          []yamlRoute `yaml:"routes"`
+		} `yaml:"email"`
+		Webhooks []struct {
+			Name            string            `yaml:"name"`
+			URL             string            `yaml:"url"`
+			Method          string            `yaml:"method"`
+			Headers         map[string]string `yaml:"headers"`
+			Template        string            `yaml:"template"`
+			Secret          string            `yaml:"secret"`
+			SignatureHeader string            `yaml:"signature_header"`
+			yamlTimeWindows `yaml:",inline"`
+			Routes          []yamlRoute `yaml:"routes"`
+		} `yaml:"webhooks"`
 	} `yaml:"output"`
 	Reminders *struct {
 		Check     yamlTimeCheck `yaml:"check"`
@@ -90,11 +191,12 @@ type yamlConfig struct {
 	} `yaml:"weather"`
 }
 
-func Load(defaultConfigData []byte) *types.Config {
+// Load reads the config file given on the command line, or config.yaml which is created if it doesn't exist
+func Load(path string, defaultConfigData []byte) *types.Config {
 	configFile := filepath.Clean("config.yaml")
 
-	if len(os.Args) == 2 {
-		configFile = filepath.Clean(os.Args[1])
+	if len(path) > 0 {
+		configFile = filepath.Clean(path)
 
 		_, err := os.Stat(configFile) //#nosec G703 -- config path is from CLI arg
 
@@ -136,11 +238,18 @@ func parseConfigFile(configFilePath string) *types.Config {
 		CheckForNewVersions: config.CheckForNewVersions,
 		DBPath:              config.DBPath,
 		LogPath:             config.LogPath,
+		Concurrency:         parseConcurrency(config),
+		Http:                parseHttp(config),
 		Output: types.Output{
 			Console:  config.Output.Console,
 			Slack:    parseSlack(config),
 			Telegram: parseTelegram(config),
 			Discord:  parseDiscord(config),
+			Matrix:   parseMatrix(config),
+			Ntfy:     parseNtfy(config),
+			Gotify:   parseGotify(config),
+			Email:    parseEmail(config),
+			Webhooks: parseWebhooks(config),
 		},
 		Reminders:   parseReminders(config),
 		Countdown:   parseCountdown(config),
@@ -150,15 +259,152 @@ func parseConfigFile(configFilePath string) *types.Config {
 	}
 }
 
+func parseConcurrency(config *yamlConfig) types.Concurrency {
+	result := types.Concurrency{
+		Workers: defaultConcurrencyWorkers,
+		PerHost: defaultConcurrencyPerHost,
+	}
+
+	if config.Concurrency.Workers < 0 || config.Concurrency.PerHost < 0 {
+		log.Panicf("Concurrency limits must be positive, got workers %d and per_host %d", config.Concurrency.Workers, config.Concurrency.PerHost)
+	}
+
+	if config.Concurrency.Workers > 0 {
+		result.Workers = config.Concurrency.Workers
+	}
+
+	if config.Concurrency.PerHost > 0 {
+		result.PerHost = config.Concurrency.PerHost
+	}
+
+	return result
+}
+
+func parseHttp(config *yamlConfig) types.Http {
+	result := types.Http{
+		UserAgent:       config.Http.UserAgent,
+		Timeout:         parseOptionalDuration("timeout", config.Http.Timeout),
+		Retries:         config.Http.Retries,
+		RetryDelay:      parseOptionalDuration("retry_delay", config.Http.RetryDelay),
+		MaxRetryDelay:   parseOptionalDuration("max_retry_delay", config.Http.MaxRetryDelay),
+		MaxResponseSize: parseSize(config.Http.MaxResponseSize),
+		Hosts:           map[string]types.HttpHost{},
+	}
+
+	if result.Retries != nil && *result.Retries < 0 {
+		log.Panicf("Invalid http retries %d, expected 0 or more", *result.Retries)
+	}
+
+	if len(config.Http.Proxy) > 0 {
+		proxy, err := url.Parse(config.Http.Proxy)
+
+		if err != nil || len(proxy.Host) == 0 {
+			log.Panicf("Invalid http proxy %q, expected a URL such as http://proxy.local:3128", config.Http.Proxy)
+		}
+
+		result.Proxy = proxy
+	}
+
+	if len(config.Http.CABundle) > 0 {
+		pem, err := os.ReadFile(filepath.Clean(config.Http.CABundle)) //#nosec G304 -- path is from user config
+
+		if err != nil {
+			log.Panicf("Could not read http ca_bundle: %v", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Panicf("No PEM certificates found in http ca_bundle %q", config.Http.CABundle)
+		}
+
+		result.RootCAs = pool
+	}
+
+	for host, settings := range config.Http.Hosts {
+		result.Hosts[strings.ToLower(host)] = types.HttpHost{
+			UserAgent: settings.UserAgent,
+			Headers:   settings.Headers,
+			Cookies:   settings.Cookies,
+			Username:  settings.Username,
+			Password:  settings.Password,
+		}
+	}
+
+	return result
+}
+
+// parseOptionalDuration returns zero when the setting is left out, so the default is used
+func parseOptionalDuration(name, value string) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil || duration <= 0 {
+		log.Panicf("Invalid http %s %q, expected a duration such as 30s or 5m", name, value)
+	}
+
+	return duration
+}
+
+// parseSize reads a size such as 512KB or 10MB in bytes, zero when it is left out
+func parseSize(value string) int64 {
+	if len(value) == 0 {
+		return 0
+	}
+
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"GB", 1 << 30},
+		{"MB", 1 << 20},
+		{"KB", 1 << 10},
+		{"B", 1},
+	}
+
+	number, multiplier := strings.ToUpper(strings.TrimSpace(value)), int64(1)
+
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number, multiplier = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix)), unit.multiplier
+			break
+		}
+	}
+
+	size, err := strconv.ParseInt(number, 10, 64)
+
+	if err != nil || size <= 0 {
+		log.Panicf("Invalid size %q, expected a size such as 512KB or 10MB", value)
+	}
+
+	return size * multiplier
+}
+
 func parseSlack(config *yamlConfig) *types.Slack {
 	if config.Output.Slack == nil {
 		return nil
 	}
 
+	listenAddress := config.Output.Slack.ListenAddress
+
+	if len(config.Output.Slack.SigningSecret) > 0 && len(listenAddress) < 1 {
+		listenAddress = ":3000"
+	}
+
 	return &types.Slack{
-		Token:     config.Output.Slack.Token,
-		ChannelId: config.Output.Slack.ChannelId,
-		Duration:  parseDuration(config.Output.Slack.From, config.Output.Slack.To),
+		Token:         config.Output.Slack.Token,
+		ChannelId:     config.Output.Slack.ChannelId,
+		SigningSecret: config.Output.Slack.SigningSecret,
+		ListenAddress: listenAddress,
+		Duration:      parseDuration(config.Output.Slack.yamlTimeWindows),
+		Routes:        parseRoutes(config.Output.Slack.Routes),
 	}
 }
 
@@ -170,7 +416,8 @@ func parseTelegram(config *yamlConfig) *types.Telegram {
 	return &types.Telegram{
 		Token:    config.Output.Telegram.Token,
 		ChatID:   config.Output.Telegram.ChatID,
-		Duration: parseDuration(config.Output.Telegram.From, config.Output.Telegram.To),
+		Duration: parseDuration(config.Output.Telegram.yamlTimeWindows),
+		Routes:   parseRoutes(config.Output.Telegram.Routes),
 	}
 }
 
@@ -181,8 +428,197 @@ func parseDiscord(config *yamlConfig) *types.Discord {
 
 	return &types.Discord{
 		WebhookURL: config.Output.Discord.WebhookURL,
-		Duration:   parseDuration(config.Output.Discord.From, config.Output.Discord.To),
+		Token:      config.Output.Discord.Token,
+		ChannelID:  config.Output.Discord.ChannelID,
+		Duration:   parseDuration(config.Output.Discord.yamlTimeWindows),
+		Routes:     parseRoutes(config.Output.Discord.Routes),
+	}
+}
+
+func parseMatrix(config *yamlConfig) *types.Matrix {
+	if config.Output.Matrix == nil {
+		return nil
+	}
+
+	return &types.Matrix{
+		Homeserver:  config.Output.Matrix.Homeserver,
+		AccessToken: config.Output.Matrix.AccessToken,
+		RoomID:      config.Output.Matrix.RoomID,
+		Duration:    parseDuration(config.Output.Matrix.yamlTimeWindows),
+		Routes:      parseRoutes(config.Output.Matrix.Routes),
+	}
+}
+
+func parseNtfy(config *yamlConfig) *types.Ntfy {
+	if config.Output.Ntfy == nil {
+		return nil
+	}
+
+	server := config.Output.Ntfy.Server
+
+	if len(server) < 1 {
+		server = "https://ntfy.sh"
+	}
+
+	return &types.Ntfy{
+		Server:   server,
+		Topic:    config.Output.Ntfy.Topic,
+		Token:    config.Output.Ntfy.Token,
+		Duration: parseDuration(config.Output.Ntfy.yamlTimeWindows),
+		Routes:   parseRoutes(config.Output.Ntfy.Routes),
+	}
+}
+
+func parseGotify(config *yamlConfig) *types.Gotify {
+	if config.Output.Gotify == nil {
+		return nil
+	}
+
+	return &types.Gotify{
+		Server:   config.Output.Gotify.Server,
+		Token:    config.Output.Gotify.Token,
+		Duration: parseDuration(config.Output.Gotify.yamlTimeWindows),
+		Routes:   parseRoutes(config.Output.Gotify.Routes),
+	}
+}
+
+func parseEmail(config *yamlConfig) *types.Email {
+	if config.Output.Email == nil {
+		return nil
+	}
+
+	email := config.Output.Email
+	security := strings.ToLower(email.Security)
+	port := email.Port
+
+	if len(security) < 1 {
+		security = "starttls"
+
+		if port == 465 {
+			security = "tls"
+		}
+	}
+
+	if port < 1 {
+		switch security {
+		case "tls":
+			port = 465
+		case "none":
+			port = 25
+		default:
+			port = 587
+		}
+	}
+
+	subject := email.Subject
+
+	if len(subject) < 1 {
+		subject = "FoxBot"
+	}
+
+	var digestAt *time.Time
+
+	if len(email.Digest) > 0 {
+		at := utils.ParseTimeFromString(email.Digest)
+		digestAt = &at
+	}
+
+	return &types.Email{
+		Host:       email.Host,
+		Port:       port,
+		Security:   security,
+		Username:   email.Username,
+		Password:   email.Password,
+		Sender:     email.Sender,
+		Recipients: email.Recipients,
+		Subject:    subject,
+		DigestAt:   digestAt,
+		Location:   parseTimezone(email.Timezone),
+		Duration:   parseDuration(email.yamlTimeWindows),
+		Routes:     parseRoutes(email.Routes),
+	}
+}
+
+func parseWebhooks(config *yamlConfig) []types.Webhook {
+	var webhooks []types.Webhook
+
+	for i, webhook := range config.Output.Webhooks {
+		name := webhook.Name
+
+		if len(name) < 1 {
+			name = strconv.Itoa(i + 1)
+		}
+
+		method := strings.ToUpper(webhook.Method)
+
+		if len(method) < 1 {
+			method = "POST"
+		}
+
+		signatureHeader := webhook.SignatureHeader
+
+		if len(webhook.Secret) > 0 && len(signatureHeader) < 1 {
+			signatureHeader = "X-FoxBot-Signature"
+		}
+
+		webhooks = append(webhooks, types.Webhook{
+			Name:            name,
+			URL:             webhook.URL,
+			Method:          method,
+			Headers:         webhook.Headers,
+			Template:        webhook.Template,
+			Secret:          webhook.Secret,
+			SignatureHeader: signatureHeader,
+			Duration:        parseDuration(webhook.yamlTimeWindows),
+			Routes:          parseRoutes(webhook.Routes),
+		})
+	}
+
+	return webhooks
+}
+
+var routeTasks = []string{
+	types.CategoryFoxBot,
+	types.CategoryReminders,
+	types.CategoryCountdown,
+	types.CategoryRSS,
+	types.CategorySiteChanges,
+	types.CategoryWeather,
+}
+
+func parseRoutes(routes []yamlRoute) []types.Route {
+	var parsed []types.Route
+
+	for _, route := range routes {
+		for _, task := range route.Tasks {
+			if !slices.Contains(routeTasks, task) {
+				log.Panicf("Unknown task %q in routes, expected one of %s", task, strings.Join(routeTasks, ", "))
+			}
+		}
+
+		var severities []types.Severity
+
+		for _, severity := range route.Severities {
+			switch strings.ToLower(severity) {
+			case "info":
+				severities = append(severities, types.SeverityInfo)
+			case "good":
+				severities = append(severities, types.SeverityGood)
+			case "bad":
+				severities = append(severities, types.SeverityBad)
+			default:
+				log.Panicf("Unknown severity %q in routes, expected info, good or bad", severity)
+			}
+		}
+
+		parsed = append(parsed, types.Route{
+			Tasks:      route.Tasks,
+			Groups:     route.Groups,
+			Severities: severities,
+		})
 	}
+
+	return parsed
 }
 
 func parseReminders(config *yamlConfig) *types.Reminders {
@@ -290,20 +726,142 @@ func parseWeather(config *yamlConfig) *types.Weather {
 }
 
 func parseTimeCheck(check yamlTimeCheck) types.TimeFrequencyAndDuration {
-	return types.TimeFrequencyAndDuration{
-		Frequency: utils.ParseDurationFromString(check.Frequency),
-		Duration:  parseDuration(check.From, check.To),
+	result := types.TimeFrequencyAndDuration{
+		Frequency: utils.ParseFrequencyFromString(check.Frequency),
+		Duration:  parseDuration(check.yamlTimeWindows),
+	}
+
+	if len(check.Jitter) > 0 {
+		jitter, err := time.ParseDuration(check.Jitter)
+
+		if err != nil || jitter < 0 {
+			log.Panicf("Invalid jitter %q, expected a duration such as 30s or 5m", check.Jitter)
+		}
+
+		result.Frequency.Jitter = jitter
+	}
+
+	if len(check.Timeout) > 0 {
+		timeout, err := time.ParseDuration(check.Timeout)
+
+		if err != nil || timeout <= 0 {
+			log.Panicf("Invalid timeout %q, expected a duration such as 30s or 5m", check.Timeout)
+		}
+
+		result.Timeout = timeout
 	}
+
+	if result.Frequency.Cron != nil {
+		// A cron expression follows the check's timezone too, which can be set without any windows
+		result.Frequency.Cron.Location = parseTimezone(check.Timezone)
+
+		if utils.NextCronTime(*result.Frequency.Cron, time.Now()).IsZero() {
+			log.Panicf("Cron expression %q never runs", check.Frequency)
+		}
+	}
+
+	return result
 }
 
-func parseDuration(from, to string) *types.TimeDuration {
-	// Both from and to need to be set
-	if len(from) < 1 || len(to) < 1 {
+func parseDuration(config yamlTimeWindows) *types.TimeDuration {
+	windows := config.Windows
+
+	if len(config.From) > 0 || len(config.To) > 0 || len(config.Days) > 0 {
+		windows = append([]yamlTimeWindow{config.yamlTimeWindow}, windows...)
+	}
+
+	if len(windows) == 0 {
+		return nil
+	}
+
+	duration := &types.TimeDuration{Location: parseTimezone(config.Timezone)}
+
+	for _, window := range windows {
+		duration.Windows = append(duration.Windows, parseTimeWindow(window))
+	}
+
+	return duration
+}
+
+// parseTimezone returns nil for the local time when no timezone is set
+func parseTimezone(timezone string) *time.Location {
+	if len(timezone) == 0 {
 		return nil
 	}
 
-	return &types.TimeDuration{
-		From: utils.ParseTimeFromString(from),
-		To:   utils.ParseTimeFromString(to),
+	location, err := time.LoadLocation(timezone)
+
+	if err != nil {
+		log.Panicf("Invalid timezone %q: %v", timezone, err)
+	}
+
+	return location
+}
+
+// parseTimeWindow covers the whole day when neither from nor to are set, so days can be used on their own
+func parseTimeWindow(window yamlTimeWindow) types.TimeWindow {
+	if len(window.From) == 0 && len(window.To) == 0 {
+		window.From, window.To = "00:00", "23:59"
 	}
+
+	// Both from and to need to be set
+	if len(window.From) == 0 || len(window.To) == 0 {
+		log.Panicf("A time window needs both from and to, got from %q to %q", window.From, window.To)
+	}
+
+	return types.TimeWindow{
+		From: utils.ParseTimeFromString(window.From),
+		To:   utils.ParseTimeFromString(window.To),
+		Days: parseDays(window.Days),
+	}
+}
+
+// parseDays accepts day names such as mon or monday, ranges such as mon-fri, weekdays and weekends
+func parseDays(days []string) []time.Weekday {
+	var result []time.Weekday
+
+	for _, value := range days {
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		switch value {
+		case "weekdays":
+			value = "mon-fri"
+		case "weekends":
+			value = "sat-sun"
+		}
+
+		first, last, isRange := strings.Cut(value, "-")
+		from := parseDay(first)
+		to := from
+
+		if isRange {
+			to = parseDay(last)
+		}
+
+		// Ranges can wrap around the week, such as fri-mon
+		for day := from; ; day = (day + 1) % 7 {
+			if !slices.Contains(result, day) {
+				result = append(result, day)
+			}
+
+			if day == to {
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+func parseDay(value string) time.Weekday {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		name := strings.ToLower(day.String())
+
+		if value == name || value == name[:3] {
+			return day
+		}
+	}
+
+	log.Panicf("Invalid day %q", value)
+	return time.Sunday
 }
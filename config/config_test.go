@@ -0,0 +1,96 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func parseTestTimeCheck(t *testing.T, data string) yamlTimeCheck {
+	t.Helper()
+
+	var check yamlTimeCheck
+	assert.NoError(t, yaml.Unmarshal([]byte(data), &check))
+
+	return check
+}
+
+func TestCronFollowsTimezoneWithoutWindows(t *testing.T) {
+	result := parseTimeCheck(parseTestTimeCheck(t, `
+frequency: "30 7 * * *"
+timezone: Asia/Tokyo
+`))
+
+	assert.Nil(t, result.Duration)
+
+	if assert.NotNil(t, result.Frequency.Cron) {
+		assert.Equal(t, "Asia/Tokyo", result.Frequency.Cron.Location.String())
+	}
+}
+
+func TestCronFollowsTimezoneWithWindows(t *testing.T) {
+	result := parseTimeCheck(parseTestTimeCheck(t, `
+frequency: "30 7 * * *"
+from: "07:00"
+to: "09:00"
+timezone: Europe/London
+`))
+
+	if assert.NotNil(t, result.Duration) {
+		assert.Equal(t, "Europe/London", result.Duration.Location.String())
+		assert.Len(t, result.Duration.Windows, 1)
+	}
+
+	assert.Equal(t, "Europe/London", result.Frequency.Cron.Location.String())
+}
+
+func TestCronWithoutTimezoneIsLocal(t *testing.T) {
+	result := parseTimeCheck(parseTestTimeCheck(t, `frequency: "30 7 * * *"`))
+
+	assert.Nil(t, result.Frequency.Cron.Location)
+}
+
+func TestInvalidTimezone(t *testing.T) {
+	assert.Panics(t, func() {
+		parseTimeCheck(parseTestTimeCheck(t, `
+frequency: "30 7 * * *"
+timezone: Mars/Olympus
+`))
+	})
+}
+
+func TestEmailDigestTimezoneWithoutWindows(t *testing.T) {
+	var config yamlConfig
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+output:
+  email:
+    digest: "08:00"
+    timezone: America/New_York
+`), &config))
+
+	email := parseEmail(&config)
+
+	assert.Nil(t, email.Duration)
+
+	if assert.NotNil(t, email.Location) {
+		assert.Equal(t, "America/New_York", email.Location.String())
+	}
+}
+
+func TestParseDurationWindows(t *testing.T) {
+	duration := parseDuration(yamlTimeWindows{
+		yamlTimeWindow: yamlTimeWindow{From: "22:00", To: "06:00"},
+		Windows:        []yamlTimeWindow{{Days: []string{"weekends"}}},
+	})
+
+	if assert.NotNil(t, duration) {
+		assert.Nil(t, duration.Location)
+		assert.Len(t, duration.Windows, 2)
+		assert.Equal(t, 22, duration.Windows[0].From.Hour())
+		assert.Equal(t, []time.Weekday{time.Saturday, time.Sunday}, duration.Windows[1].Days)
+	}
+
+	assert.Nil(t, parseDuration(yamlTimeWindows{}))
+}
@@ -2,10 +2,14 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
-	"slices"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/antfie/FoxBot/types"
 	_ "modernc.org/sqlite"
 )
 
@@ -42,6 +46,20 @@ func NewDB(dbPath string) *DB {
 	return &DB{db: db}
 }
 
+// Close checkpoints the WAL and closes the database, once nothing else will use it
+func (db *DB) Close() {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, err := db.db.Exec("PRAGMA wal_checkpoint(TRUNCATE)"); err != nil {
+		log.Print(err)
+	}
+
+	if err := db.db.Close(); err != nil {
+		log.Print(err)
+	}
+}
+
 func (db *DB) Query(query string, args ...any) *sql.Rows {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -118,24 +136,38 @@ func (db *DB) IsRSSLinkInDB(link string) bool {
 	return found
 }
 
-func (db *DB) QueueTelegramNotification(message string) {
+// Notification outbox methods
+
+const (
+	deliveredNotificationRetentionDays = 7
+	deadNotificationRetentionDays      = 30
+)
+
+func (db *DB) QueueNotification(channel string, severity types.Severity, payload string) {
+	db.QueueFeedbackNotification(channel, severity, payload, "")
+}
+
+// QueueFeedbackNotification queues an RSS item to be sent with feedback buttons for the given article
+func (db *DB) QueueFeedbackNotification(channel string, severity types.Severity, payload, articleHash string) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	success := db.insert("INSERT INTO telegram_notification(message) VALUES (?)", message)
+	success := db.insert("INSERT INTO notification_outbox (channel, severity, payload, article_hash) VALUES (?, ?, ?, ?)", channel, severity, payload, articleHash)
 
 	if !success {
-		log.Print("Could not queue telegram notification")
+		log.Printf("Could not queue %s notification", channel)
 	}
 }
 
-func (db *DB) ConsumeTelegramNotificationQueue() []string {
+// LeaseNotifications hands out the pending notifications for a channel. They are hidden from other
+// leases until the lease expires, so a crash mid-send means they are retried rather than lost.
+func (db *DB) LeaseNotifications(channel string, lease time.Duration) []types.QueuedNotification {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	var results []string
+	var results []types.QueuedNotification
 
-	rows, err := db.db.Query("SELECT message FROM telegram_notification ORDER BY created")
+	rows, err := db.db.Query("SELECT id, severity, payload, article_hash, attempts FROM notification_outbox WHERE channel = ? AND delivered_at IS NULL AND dead_at IS NULL AND next_attempt_at <= CURRENT_TIMESTAMP ORDER BY id", channel)
 
 	if err != nil {
 		log.Print(err)
@@ -143,17 +175,16 @@ func (db *DB) ConsumeTelegramNotificationQueue() []string {
 	}
 
 	for rows.Next() {
-		var value string
-		err = rows.Scan(&value)
+		var value types.QueuedNotification
+		err = rows.Scan(&value.ID, &value.Severity, &value.Payload, &value.ArticleHash, &value.Attempts)
 
 		if err != nil {
 			log.Print(err)
 			continue
 		}
 
-		if !slices.Contains(results, value) {
-			results = append(results, value)
-		}
+		value.Attempts++
+		results = append(results, value)
 	}
 
 	err = rows.Err()
@@ -168,24 +199,109 @@ func (db *DB) ConsumeTelegramNotificationQueue() []string {
 		log.Print(err)
 	}
 
-	_, err = db.db.Exec("DELETE FROM telegram_notification")
+	if len(results) == 0 {
+		return results
+	}
+
+	_, err = db.db.Exec(fmt.Sprintf("UPDATE notification_outbox SET attempts = attempts + 1, next_attempt_at = datetime('now', '+%d seconds') WHERE id IN (%s)", int(lease.Seconds()), notificationIDs(results)))
 
 	if err != nil {
 		log.Print(err)
+		return nil
 	}
 
 	return results
 }
 
-func (db *DB) QueueSlackNotification(message string) {
+func (db *DB) AckNotifications(notifications []types.QueuedNotification) {
+	if len(notifications) == 0 {
+		return
+	}
+
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	success := db.insert("INSERT INTO slack_notification(message) VALUES (?)", message)
+	_, err := db.db.Exec(fmt.Sprintf("UPDATE notification_outbox SET delivered_at = CURRENT_TIMESTAMP, last_error = NULL WHERE id IN (%s)", notificationIDs(notifications)))
 
-	if !success {
-		log.Print("Could not queue slack notification")
+	if err != nil {
+		log.Print(err)
+	}
+
+	_, err = db.db.Exec(fmt.Sprintf("DELETE FROM notification_outbox WHERE delivered_at < datetime('now', '-%d day') OR dead_at < datetime('now', '-%d day')", deliveredNotificationRetentionDays, deadNotificationRetentionDays))
+
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+// RetryNotifications schedules another attempt with exponential backoff (baseDelay doubled per attempt, capped at
+// maxDelay). Notifications that have used up maxAttempts are dead-lettered instead.
+func (db *DB) RetryNotifications(notifications []types.QueuedNotification, reason string, maxAttempts int, baseDelay, maxDelay time.Duration) {
+	if len(notifications) == 0 {
+		return
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	query := fmt.Sprintf(`UPDATE notification_outbox SET
+		last_error = ?,
+		dead_at = CASE WHEN attempts >= ? THEN CURRENT_TIMESTAMP END,
+		next_attempt_at = datetime('now', '+' || MIN(? * (1 << MIN(attempts - 1, 30)), ?) || ' seconds')
+		WHERE id IN (%s)`, notificationIDs(notifications))
+
+	_, err := db.db.Exec(query, reason, maxAttempts, int(baseDelay.Seconds()), int(maxDelay.Seconds()))
+
+	if err != nil {
+		log.Print(err)
+	}
+}
+
+func (db *DB) CountPendingNotifications() map[string]int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	result := make(map[string]int)
+
+	rows, err := db.db.Query("SELECT channel, COUNT(*) FROM notification_outbox WHERE delivered_at IS NULL AND dead_at IS NULL GROUP BY channel")
+
+	if err != nil {
+		log.Print(err)
+		return result
+	}
+
+	for rows.Next() {
+		var channel string
+		var count int
+		err = rows.Scan(&channel, &count)
+
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+
+		result[channel] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		log.Print(err)
 	}
+
+	if err = rows.Close(); err != nil {
+		log.Print(err)
+	}
+
+	return result
+}
+
+func notificationIDs(notifications []types.QueuedNotification) string {
+	ids := make([]string, len(notifications))
+
+	for i, n := range notifications {
+		ids[i] = strconv.FormatInt(n.ID, 10)
+	}
+
+	return strings.Join(ids, ",")
 }
 
 // Bayes methods
@@ -316,6 +432,94 @@ func (db *DB) BayesSetArticleLabel(hash, label string) {
 	db.insert("UPDATE bayes_article SET label = ? WHERE hash = ?", label, hash)
 }
 
+// BayesSaveArticleMessage records the message an article was sent as, so the channel can update it after feedback
+func (db *DB) BayesSaveArticleMessage(hash, channel, messageID string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insert("INSERT INTO bayes_article_message (hash, channel, message_id) VALUES (?, ?, ?) ON CONFLICT(hash, channel) DO UPDATE SET message_id = ?", hash, channel, messageID, messageID)
+}
+
+func (db *DB) BayesGetArticleMessage(hash, channel string) string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	row := db.db.QueryRow("SELECT message_id FROM bayes_article_message WHERE hash = ? AND channel = ?", hash, channel)
+
+	var messageID string
+	err := row.Scan(&messageID)
+
+	if err != nil {
+		return ""
+	}
+
+	return messageID
+}
+
+// BayesGetArticleByMessage is the reverse of BayesGetArticleMessage, for channels that report feedback against a message
+func (db *DB) BayesGetArticleByMessage(channel, messageID string) string {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	row := db.db.QueryRow("SELECT hash FROM bayes_article_message WHERE channel = ? AND message_id = ?", channel, messageID)
+
+	var hash string
+	err := row.Scan(&hash)
+
+	if err != nil {
+		return ""
+	}
+
+	return hash
+}
+
+// BayesGetMessageReactionLabel returns the label a message's reactions added up to when they were last read.
+// It returns false if they have not been read yet.
+func (db *DB) BayesGetMessageReactionLabel(channel, messageID string) (string, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	row := db.db.QueryRow("SELECT reaction_label FROM bayes_article_message WHERE channel = ? AND message_id = ?", channel, messageID)
+
+	var label sql.NullString
+	err := row.Scan(&label)
+
+	if err != nil || !label.Valid {
+		return "", false
+	}
+
+	return label.String, true
+}
+
+func (db *DB) BayesSetMessageReactionLabel(channel, messageID, label string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insert("UPDATE bayes_article_message SET reaction_label = ? WHERE channel = ? AND message_id = ?", label, channel, messageID)
+}
+
+func (db *DB) BayesSaveArticleReaction(channel, reactionID, hash, label string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insert("INSERT INTO bayes_article_reaction (channel, reaction_id, hash, label) VALUES (?, ?, ?, ?) ON CONFLICT(channel, reaction_id) DO UPDATE SET hash = ?, label = ?", channel, reactionID, hash, label, hash, label)
+}
+
+// BayesTakeArticleReaction returns the article and label a reaction gave, and forgets the reaction.
+// It returns false if the reaction is not known.
+func (db *DB) BayesTakeArticleReaction(channel, reactionID string) (hash, label string, found bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	row := db.db.QueryRow("DELETE FROM bayes_article_reaction WHERE channel = ? AND reaction_id = ? RETURNING hash, label", channel, reactionID)
+
+	if err := row.Scan(&hash, &label); err != nil {
+		return "", "", false
+	}
+
+	return hash, label, true
+}
+
 func (db *DB) BayesCleanupOldArticles() {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -325,13 +529,25 @@ func (db *DB) BayesCleanupOldArticles() {
 	if err != nil {
 		log.Print(err)
 	}
+
+	_, err = db.db.Exec("DELETE FROM bayes_article_message WHERE hash NOT IN (SELECT hash FROM bayes_article)")
+
+	if err != nil {
+		log.Print(err)
+	}
+	_, err = db.db.Exec("DELETE FROM bayes_article_reaction WHERE hash NOT IN (SELECT hash FROM bayes_article)")
+
+	if err != nil {
+		log.Print(err)
+	}
 }
 
-func (db *DB) GetTelegramState(key string) string {
+// GetIntegrationState returns a value an integration saved to pick up where it left off, such as a polling offset
+func (db *DB) GetIntegrationState(integration, key string) string {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	row := db.db.QueryRow("SELECT value FROM telegram_state WHERE key = ?", key)
+	row := db.db.QueryRow("SELECT value FROM integration_state WHERE integration = ? AND key = ?", integration, key)
 
 	var value string
 	err := row.Scan(&value)
@@ -343,11 +559,39 @@ func (db *DB) GetTelegramState(key string) string {
 	return value
 }
 
-func (db *DB) SetTelegramState(key, value string) {
+func (db *DB) SetIntegrationState(integration, key, value string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insert("INSERT INTO integration_state (integration, key, value) VALUES (?, ?, ?) ON CONFLICT(integration, key) DO UPDATE SET value = ?", integration, key, value, value)
+}
+
+// Feed group mute methods
+
+func (db *DB) MuteFeedGroup(feedGroup string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.insert("INSERT OR IGNORE INTO muted_feed_group (feed_group) VALUES (?)", feedGroup)
+}
+
+func (db *DB) UnmuteFeedGroup(feedGroup string) bool {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	db.insert("INSERT INTO telegram_state (key, value) VALUES (?, ?) ON CONFLICT(key) DO UPDATE SET value = ?", key, value, value)
+	return db.insert("DELETE FROM muted_feed_group WHERE feed_group = ?", feedGroup)
+}
+
+func (db *DB) IsFeedGroupMuted(feedGroup string) bool {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	row := db.db.QueryRow("SELECT 1 FROM muted_feed_group WHERE feed_group = ?", feedGroup)
+
+	var dummy int
+	err := row.Scan(&dummy)
+
+	return err == nil
 }
 
 // HTTP cache methods
@@ -413,109 +657,54 @@ func (db *DB) SetWeatherNotified(location string) {
 	db.insert("INSERT INTO weather_notification (location, last_notified) VALUES (?, date('now')) ON CONFLICT(location) DO UPDATE SET last_notified = date('now')", location)
 }
 
-func (db *DB) QueueDiscordNotification(message string) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
-	success := db.insert("INSERT INTO discord_notification(message) VALUES (?)", message)
+// Task run methods
 
-	if !success {
-		log.Print("Could not queue discord notification")
-	}
-}
+const taskRunRetentionDays = 30
 
-func (db *DB) ConsumeDiscordNotificationQueue() []string {
+func (db *DB) SaveTaskRun(run types.TaskRun) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	var results []string
+	success := db.insert("INSERT INTO task_run (task, started, finished, outcome, error, items) VALUES (?, ?, ?, ?, ?, ?)", run.Task, run.Started.UTC(), run.Finished.UTC(), run.Outcome, run.Error, run.Items)
 
-	rows, err := db.db.Query("SELECT message FROM discord_notification ORDER BY created")
-
-	if err != nil {
-		log.Print(err)
-		return results
-	}
-
-	for rows.Next() {
-		var value string
-		err = rows.Scan(&value)
-
-		if err != nil {
-			log.Print(err)
-			continue
-		}
-
-		if !slices.Contains(results, value) {
-			results = append(results, value)
-		}
-	}
-
-	err = rows.Err()
-
-	if err != nil {
-		log.Print(err)
-	}
-
-	err = rows.Close()
-
-	if err != nil {
-		log.Print(err)
+	if !success {
+		log.Printf("Could not save %s task run", run.Task)
 	}
 
-	_, err = db.db.Exec("DELETE FROM discord_notification")
+	_, err := db.db.Exec(fmt.Sprintf("DELETE FROM task_run WHERE started < datetime('now', '-%d day')", taskRunRetentionDays))
 
 	if err != nil {
 		log.Print(err)
 	}
-
-	return results
 }
 
-func (db *DB) ConsumeSlackNotificationQueue() []string {
+// GetLastTaskRun returns the task's most recent run, if it has one
+func (db *DB) GetLastTaskRun(task string) (types.TaskRun, bool) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	var results []string
+	run := types.TaskRun{Task: task}
+	row := db.db.QueryRow("SELECT started, finished, outcome, error, items FROM task_run WHERE task = ? ORDER BY started DESC, id DESC LIMIT 1", task)
+	err := row.Scan(&run.Started, &run.Finished, &run.Outcome, &run.Error, &run.Items)
 
-	rows, err := db.db.Query("SELECT message FROM slack_notification ORDER BY created")
-
-	if err != nil {
-		log.Print(err)
-		return results
-	}
-
-	for rows.Next() {
-		var value string
-		err = rows.Scan(&value)
-
-		if err != nil {
-			log.Print(err)
-			continue
-		}
-
-		if !slices.Contains(results, value) {
-			results = append(results, value)
-		}
-	}
-
-	err = rows.Err()
-
-	if err != nil {
-		log.Print(err)
-	}
+	return run, err == nil
+}
 
-	err = rows.Close()
+// GetTaskNextRun returns when the task was last scheduled to run next, so a restart can pick up from there
+func (db *DB) GetTaskNextRun(task string) (time.Time, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	if err != nil {
-		log.Print(err)
-	}
+	var next time.Time
+	row := db.db.QueryRow("SELECT next_run FROM task_schedule WHERE task = ?", task)
+	err := row.Scan(&next)
 
-	_, err = db.db.Exec("DELETE FROM slack_notification")
+	return next, err == nil
+}
 
-	if err != nil {
-		log.Print(err)
-	}
+func (db *DB) SetTaskNextRun(task string, next time.Time) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
 
-	return results
+	db.insert("INSERT INTO task_schedule (task, next_run) VALUES (?, ?) ON CONFLICT(task) DO UPDATE SET next_run = excluded.next_run", task, next.UTC())
 }
@@ -3,7 +3,9 @@ package db
 import (
 	"os"
 	"testing"
+	"time"
 
+	"github.com/antfie/FoxBot/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -34,70 +36,153 @@ func TestIsRSSLinkInDB(t *testing.T) {
 	assert.False(t, db.IsRSSLinkInDB("https://example.com/article2"))
 }
 
-func TestQueueAndConsumeSlackNotifications(t *testing.T) {
+func payloads(notifications []types.QueuedNotification) []string {
+	var result []string
+
+	for _, n := range notifications {
+		result = append(result, n.Payload)
+	}
+
+	return result
+}
+
+func TestLeaseAndAckNotifications(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
 
 	// Empty queue
-	messages := db.ConsumeSlackNotificationQueue()
-	assert.Empty(t, messages)
+	assert.Empty(t, db.LeaseNotifications("slack", time.Minute))
+
+	db.QueueNotification("slack", types.SeverityInfo, "hello")
+	db.QueueNotification("slack", types.SeverityBad, "world")
 
-	// Queue messages
-	db.QueueSlackNotification("hello")
-	db.QueueSlackNotification("world")
+	leased := db.LeaseNotifications("slack", time.Minute)
+	assert.Equal(t, []string{"hello", "world"}, payloads(leased))
+	assert.Equal(t, types.SeverityBad, leased[1].Severity)
+	assert.Equal(t, 1, leased[0].Attempts)
 
-	// Consume returns all messages
-	messages = db.ConsumeSlackNotificationQueue()
-	assert.Equal(t, []string{"hello", "world"}, messages)
+	// Leased rows are hidden until the lease expires
+	assert.Empty(t, db.LeaseNotifications("slack", time.Minute))
 
-	// Queue is now empty
-	messages = db.ConsumeSlackNotificationQueue()
-	assert.Empty(t, messages)
+	db.AckNotifications(leased)
+
+	var pending int
+	row := db.db.QueryRow("SELECT COUNT(*) FROM notification_outbox WHERE delivered_at IS NULL")
+	assert.NoError(t, row.Scan(&pending))
+	assert.Equal(t, 0, pending)
 }
 
-func TestQueueSlackNotificationDeduplicates(t *testing.T) {
+func TestExpiredLeaseIsRedelivered(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	db.QueueSlackNotification("duplicate")
-	db.QueueSlackNotification("duplicate")
-	db.QueueSlackNotification("unique")
+	db.QueueNotification("telegram", types.SeverityInfo, "not acknowledged")
+
+	// A zero lease behaves like a crash straight after leasing
+	assert.Len(t, db.LeaseNotifications("telegram", 0), 1)
 
-	messages := db.ConsumeSlackNotificationQueue()
-	assert.Equal(t, []string{"duplicate", "unique"}, messages)
+	leased := db.LeaseNotifications("telegram", time.Minute)
+	assert.Equal(t, []string{"not acknowledged"}, payloads(leased))
+	assert.Equal(t, 2, leased[0].Attempts)
 }
 
-func TestQueueAndConsumeDiscordNotifications(t *testing.T) {
+func TestRetryNotificationsBacksOffAndDeadLetters(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	// Empty queue
-	messages := db.ConsumeDiscordNotificationQueue()
-	assert.Empty(t, messages)
+	db.QueueNotification("discord", types.SeverityInfo, "flaky")
+
+	leased := db.LeaseNotifications("discord", time.Minute)
+	db.RetryNotifications(leased, "boom", 2, time.Minute, time.Hour)
+
+	// Backed off, so not immediately available
+	assert.Empty(t, db.LeaseNotifications("discord", time.Minute))
+
+	db.Exec("UPDATE notification_outbox SET next_attempt_at = CURRENT_TIMESTAMP")
+	leased = db.LeaseNotifications("discord", time.Minute)
+	assert.Equal(t, 2, leased[0].Attempts)
+
+	db.RetryNotifications(leased, "boom again", 2, time.Minute, time.Hour)
+	db.Exec("UPDATE notification_outbox SET next_attempt_at = CURRENT_TIMESTAMP")
+
+	// Out of attempts - dead-lettered
+	assert.Empty(t, db.LeaseNotifications("discord", time.Minute))
+
+	var lastError string
+	row := db.db.QueryRow("SELECT last_error FROM notification_outbox WHERE dead_at IS NOT NULL")
+	assert.NoError(t, row.Scan(&lastError))
+	assert.Equal(t, "boom again", lastError)
+}
+
+func TestNotificationQueuesAreIsolatedPerChannel(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	db.QueueNotification("slack", types.SeverityInfo, "for slack")
+	db.QueueNotification("telegram", types.SeverityInfo, "for telegram")
+
+	assert.Equal(t, []string{"for slack"}, payloads(db.LeaseNotifications("slack", time.Minute)))
+	assert.Equal(t, []string{"for telegram"}, payloads(db.LeaseNotifications("telegram", time.Minute)))
+	assert.Empty(t, db.LeaseNotifications("discord", time.Minute))
+}
+
+func TestQueueFeedbackNotificationKeepsArticleHash(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	db.QueueNotification("telegram", types.SeverityInfo, "plain")
+	db.QueueFeedbackNotification("telegram", types.SeverityGood, `{"Title":"rss"}`, "abc123")
+
+	leased := db.LeaseNotifications("telegram", time.Minute)
+	assert.Len(t, leased, 2)
+	assert.Empty(t, leased[0].ArticleHash)
+	assert.Equal(t, "abc123", leased[1].ArticleHash)
+}
+
+func TestTaskRuns(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	_, found := db.GetLastTaskRun("rss")
+	assert.False(t, found)
+
+	started := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	db.SaveTaskRun(types.TaskRun{Task: "rss", Started: started.Add(-time.Hour), Finished: started.Add(-time.Hour), Outcome: types.TaskOutcomeSuccess})
+	db.SaveTaskRun(types.TaskRun{Task: "rss", Started: started, Finished: started.Add(3 * time.Second), Outcome: types.TaskOutcomeFailed, Error: "boom", Items: 4})
+	db.SaveTaskRun(types.TaskRun{Task: "weather", Started: started, Finished: started, Outcome: types.TaskOutcomeSuccess})
 
-	// Queue messages
-	db.QueueDiscordNotification("hello")
-	db.QueueDiscordNotification("world")
+	run, found := db.GetLastTaskRun("rss")
+	assert.True(t, found)
+	assert.True(t, started.Equal(run.Started))
+	assert.Equal(t, 3*time.Second, run.Finished.Sub(run.Started))
+	assert.Equal(t, types.TaskOutcomeFailed, run.Outcome)
+	assert.Equal(t, "boom", run.Error)
+	assert.Equal(t, 4, run.Items)
 
-	// Consume returns all messages
-	messages = db.ConsumeDiscordNotificationQueue()
-	assert.Equal(t, []string{"hello", "world"}, messages)
+	// Old runs are cleaned up
+	db.SaveTaskRun(types.TaskRun{Task: "rss", Started: started.AddDate(0, 0, -31), Finished: started.AddDate(0, 0, -31), Outcome: types.TaskOutcomeSuccess})
 
-	// Queue is now empty
-	messages = db.ConsumeDiscordNotificationQueue()
-	assert.Empty(t, messages)
+	var count int
+	row := db.db.QueryRow("SELECT COUNT(*) FROM task_run WHERE task = 'rss'")
+	assert.NoError(t, row.Scan(&count))
+	assert.Equal(t, 2, count)
 }
 
-func TestQueueDiscordNotificationDeduplicates(t *testing.T) {
+func TestTaskNextRun(t *testing.T) {
 	db, cleanup := setupTestDB(t)
 	defer cleanup()
 
-	db.QueueDiscordNotification("duplicate")
-	db.QueueDiscordNotification("duplicate")
-	db.QueueDiscordNotification("unique")
+	_, found := db.GetTaskNextRun("rss")
+	assert.False(t, found)
 
-	messages := db.ConsumeDiscordNotificationQueue()
-	assert.Equal(t, []string{"duplicate", "unique"}, messages)
+	next := time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC)
+	db.SetTaskNextRun("rss", next)
+	db.SetTaskNextRun("rss", next.Add(time.Hour))
+
+	saved, found := db.GetTaskNextRun("rss")
+	assert.True(t, found)
+	assert.True(t, next.Add(time.Hour).Equal(saved))
 }
 
 func TestWeatherNotification(t *testing.T) {
@@ -130,3 +215,73 @@ func TestExec(t *testing.T) {
 	// Should be gone - next call inserts again and returns false
 	assert.False(t, db.IsRSSLinkInDB("https://example.com/old"))
 }
+
+func TestBayesArticleMessage(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	db.BayesSaveArticle("abc123", "News", "A headline")
+	assert.Equal(t, "", db.BayesGetArticleMessage("abc123", "telegram"))
+
+	db.BayesSaveArticleMessage("abc123", "telegram", "42")
+	assert.Equal(t, "42", db.BayesGetArticleMessage("abc123", "telegram"))
+	assert.Equal(t, "", db.BayesGetArticleMessage("abc123", "discord"))
+	assert.Equal(t, "abc123", db.BayesGetArticleByMessage("telegram", "42"))
+	assert.Equal(t, "", db.BayesGetArticleByMessage("discord", "42"))
+
+	_, seen := db.BayesGetMessageReactionLabel("telegram", "42")
+	assert.False(t, seen)
+
+	db.BayesSetMessageReactionLabel("telegram", "42", "relevant")
+	label, seen := db.BayesGetMessageReactionLabel("telegram", "42")
+	assert.True(t, seen)
+	assert.Equal(t, "relevant", label)
+
+	db.BayesSetMessageReactionLabel("telegram", "42", "")
+	label, seen = db.BayesGetMessageReactionLabel("telegram", "42")
+	assert.True(t, seen)
+	assert.Equal(t, "", label)
+
+	// Cleaned up along with the article
+	db.Exec("UPDATE bayes_article SET created = date('now', '-31 day')")
+	db.BayesCleanupOldArticles()
+	assert.Equal(t, "", db.BayesGetArticleMessage("abc123", "telegram"))
+}
+
+func TestBayesArticleReaction(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	db.BayesSaveArticle("abc123", "News", "A headline")
+	db.BayesSaveArticleReaction("matrix", "$reaction", "abc123", "irrelevant")
+
+	hash, label, found := db.BayesTakeArticleReaction("matrix", "$reaction")
+	assert.True(t, found)
+	assert.Equal(t, "abc123", hash)
+	assert.Equal(t, "irrelevant", label)
+
+	// Taken only once
+	_, _, found = db.BayesTakeArticleReaction("matrix", "$reaction")
+	assert.False(t, found)
+
+	// Cleaned up along with the article
+	db.BayesSaveArticleReaction("matrix", "$another", "abc123", "relevant")
+	db.Exec("UPDATE bayes_article SET created = date('now', '-31 day')")
+	db.BayesCleanupOldArticles()
+	_, _, found = db.BayesTakeArticleReaction("matrix", "$another")
+	assert.False(t, found)
+}
+
+func TestIntegrationState(t *testing.T) {
+	db, cleanup := setupTestDB(t)
+	defer cleanup()
+
+	assert.Equal(t, "", db.GetIntegrationState("telegram", "update_offset"))
+
+	db.SetIntegrationState("telegram", "update_offset", "10")
+	db.SetIntegrationState("matrix", "next_batch", "s72_594")
+	db.SetIntegrationState("telegram", "update_offset", "11")
+
+	assert.Equal(t, "11", db.GetIntegrationState("telegram", "update_offset"))
+	assert.Equal(t, "s72_594", db.GetIntegrationState("matrix", "next_batch"))
+}
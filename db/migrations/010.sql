@@ -0,0 +1,20 @@
+CREATE TABLE notification_outbox (
+    id              INTEGER PRIMARY KEY AUTOINCREMENT,
+    channel         TEXT NOT NULL,
+    severity        INTEGER NOT NULL DEFAULT 0,
+    payload         TEXT NOT NULL,
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    delivered_at    DATETIME,
+    created         DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX idx_notification_outbox_pending ON notification_outbox(channel, delivered_at, next_attempt_at);
+
+INSERT INTO notification_outbox (channel, payload, created) SELECT 'slack', message, created FROM slack_notification ORDER BY created;
+INSERT INTO notification_outbox (channel, payload, created) SELECT 'telegram', message, created FROM telegram_notification ORDER BY created;
+INSERT INTO notification_outbox (channel, payload, created) SELECT 'discord', message, created FROM discord_notification ORDER BY created;
+
+DROP TABLE slack_notification;
+DROP TABLE telegram_notification;
+DROP TABLE discord_notification;
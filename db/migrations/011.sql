@@ -0,0 +1,5 @@
+ALTER TABLE notification_outbox ADD COLUMN dead_at DATETIME;
+ALTER TABLE notification_outbox ADD COLUMN last_error TEXT;
+
+DROP INDEX idx_notification_outbox_pending;
+CREATE INDEX idx_notification_outbox_pending ON notification_outbox(channel, delivered_at, dead_at, next_attempt_at);
@@ -0,0 +1,4 @@
+CREATE TABLE muted_feed_group (
+    feed_group TEXT PRIMARY KEY,
+    created    DATETIME DEFAULT CURRENT_TIMESTAMP
+);
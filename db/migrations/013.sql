@@ -0,0 +1,6 @@
+CREATE TABLE bayes_article_message (
+    hash       TEXT NOT NULL,
+    channel    TEXT NOT NULL,
+    message_id TEXT NOT NULL,
+    PRIMARY KEY (hash, channel)
+);
@@ -0,0 +1,10 @@
+CREATE TABLE integration_state (
+    integration TEXT NOT NULL,
+    key         TEXT NOT NULL,
+    value       TEXT NOT NULL,
+    PRIMARY KEY (integration, key)
+);
+
+INSERT INTO integration_state (integration, key, value) SELECT 'telegram', key, value FROM telegram_state;
+
+DROP TABLE telegram_state;
@@ -0,0 +1 @@
+ALTER TABLE notification_outbox ADD COLUMN article_hash TEXT NOT NULL DEFAULT '';
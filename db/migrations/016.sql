@@ -0,0 +1,16 @@
+CREATE TABLE task_run (
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    task     TEXT NOT NULL,
+    started  DATETIME NOT NULL,
+    finished DATETIME NOT NULL,
+    outcome  TEXT NOT NULL,
+    error    TEXT NOT NULL DEFAULT '',
+    items    INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_task_run_task_started ON task_run(task, started);
+
+CREATE TABLE task_schedule (
+    task     TEXT PRIMARY KEY,
+    next_run DATETIME NOT NULL
+);
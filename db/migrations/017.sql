@@ -0,0 +1,2 @@
+-- The label a message's reactions added up to when last read, NULL until they have been read
+ALTER TABLE bayes_article_message ADD COLUMN reaction_label TEXT;
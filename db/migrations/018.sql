@@ -0,0 +1,7 @@
+CREATE TABLE bayes_article_reaction (
+    channel     TEXT NOT NULL,
+    reaction_id TEXT NOT NULL,
+    hash        TEXT NOT NULL,
+    label       TEXT NOT NULL,
+    PRIMARY KEY (channel, reaction_id)
+);
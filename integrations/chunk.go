@@ -0,0 +1,305 @@
+package integrations
+
+import (
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Platform message size limits. Lengths are measured in UTF-16 code units, which is what Telegram counts.
+const (
+	telegramMessageLimit = 4096
+	// Matrix limits events to 64KiB, which has to hold the plain and HTML bodies
+	matrixMessageLimit = 10000
+)
+
+type messageChunk struct {
+	text string
+	// Indexes of the messages that are wholly or partly in this chunk
+	messages []int
+}
+
+// separateMessages puts each message in a chunk of its own, for outputs that cannot combine messages
+func separateMessages(messages []string) []messageChunk {
+	chunks := make([]messageChunk, len(messages))
+
+	for i, message := range messages {
+		chunks[i] = messageChunk{text: message, messages: []int{i}}
+	}
+
+	return chunks
+}
+
+// batchMessages groups messages in order, up to size to a batch, for outputs that send them as embeds or blocks
+func batchMessages(messages []string, size int) []messageChunk {
+	var chunks []messageChunk
+
+	for start := 0; start < len(messages); start += size {
+		chunk := messageChunk{}
+
+		for i := start; i < min(start+size, len(messages)); i++ {
+			chunk.messages = append(chunk.messages, i)
+		}
+
+		chunks = append(chunks, chunk)
+	}
+
+	return chunks
+}
+
+// chunkMessages joins messages with newlines into as few posts as possible without exceeding limit. Messages are
+// only split when a single message is longer than the limit, preferring line breaks. Set html for outputs that
+// send HTML, so that a split does not break a tag or entity.
+func chunkMessages(messages []string, limit int, html bool) []messageChunk {
+	var chunks []messageChunk
+	var current strings.Builder
+	var currentMessages []int
+	currentLength := 0
+
+	flush := func() {
+		if len(currentMessages) == 0 {
+			return
+		}
+
+		chunks = append(chunks, messageChunk{text: current.String(), messages: currentMessages})
+		current.Reset()
+		currentMessages = nil
+		currentLength = 0
+	}
+
+	for i, message := range messages {
+		for _, part := range splitMessage(message, limit, html) {
+			partLength := messageLength(part)
+
+			if currentLength > 0 && currentLength+1+partLength > limit {
+				flush()
+			}
+
+			if currentLength > 0 {
+				current.WriteByte('\n')
+				currentLength++
+			}
+
+			current.WriteString(part)
+			currentLength += partLength
+
+			if !slices.Contains(currentMessages, i) {
+				currentMessages = append(currentMessages, i)
+			}
+		}
+	}
+
+	flush()
+
+	return chunks
+}
+
+// splitMessage cuts a message longer than limit into parts, preferring line breaks. HTML messages are only cut
+// between tags and entities, and any tags still open at a cut are closed and opened again in the next part.
+func splitMessage(message string, limit int, html bool) []string {
+	if messageLength(message) <= limit {
+		return []string{message}
+	}
+
+	s := &messageSplitter{limit: limit, html: html}
+
+	for i, line := range strings.Split(message, "\n") {
+		s.addLine(messageTokens(line, html), i > 0)
+	}
+
+	return s.finish()
+}
+
+type messageSplitter struct {
+	limit   int
+	html    bool
+	parts   []string
+	current []string
+	length  int
+	// The tags open at the end of current, outermost first
+	open []string
+	// The tags open when current was started, which it opens again
+	reopened int
+}
+
+// addLine adds a line to the current part if it fits, otherwise it starts a new part and cuts the line if needed
+func (s *messageSplitter) addLine(tokens []string, newline bool) {
+	lineLength := 0
+
+	for _, token := range tokens {
+		lineLength += messageLength(token)
+	}
+
+	separator := 0
+
+	if newline && s.hasContent() {
+		separator = 1
+	}
+
+	if s.length+separator+lineLength+closingLength(s.openAfter(tokens)) > s.limit {
+		s.cut()
+		separator = 0
+	}
+
+	if separator > 0 {
+		s.current = append(s.current, "\n")
+		s.length++
+	}
+
+	for _, token := range tokens {
+		tokenLength := messageLength(token)
+
+		if s.hasContent() && s.length+tokenLength+closingLength(s.openAfter([]string{token})) > s.limit {
+			s.cut()
+		}
+
+		s.current = append(s.current, token)
+		s.length += tokenLength
+		s.open = s.openAfter([]string{token})
+	}
+}
+
+// hasContent is true once the part holds more than the tags it opens again
+func (s *messageSplitter) hasContent() bool {
+	return len(s.current) > s.reopened
+}
+
+// cut ends the current part, closing its open tags, and starts the next by opening them again
+func (s *messageSplitter) cut() {
+	if !s.hasContent() {
+		return
+	}
+
+	for i := len(s.open) - 1; i >= 0; i-- {
+		s.current = append(s.current, "</"+tagName(s.open[i])+">")
+	}
+
+	s.parts = append(s.parts, strings.Join(s.current, ""))
+	s.current = slices.Clone(s.open)
+	s.reopened = len(s.open)
+	s.length = 0
+
+	for _, tag := range s.open {
+		s.length += messageLength(tag)
+	}
+}
+
+func (s *messageSplitter) finish() []string {
+	if s.hasContent() {
+		s.parts = append(s.parts, strings.Join(s.current, ""))
+	}
+
+	return s.parts
+}
+
+// openAfter returns the tags that would be open once the tokens are added
+func (s *messageSplitter) openAfter(tokens []string) []string {
+	if !s.html {
+		return nil
+	}
+
+	open := slices.Clone(s.open)
+
+	for _, token := range tokens {
+		if !strings.HasPrefix(token, "<") || len(token) < 3 {
+			continue
+		}
+
+		name := tagName(token)
+
+		switch {
+		case strings.HasPrefix(token, "</"):
+			// Closes the innermost tag of that name, along with anything left open inside it
+			for i := len(open) - 1; i >= 0; i-- {
+				if tagName(open[i]) == name {
+					open = open[:i]
+					break
+				}
+			}
+		case strings.HasSuffix(token, "/>") || slices.Contains(voidTags, name):
+		default:
+			open = append(open, token)
+		}
+	}
+
+	return open
+}
+
+// Tags that have no closing tag
+var voidTags = []string{"br", "hr", "img"}
+
+func closingLength(open []string) int {
+	length := 0
+
+	for _, tag := range open {
+		length += len("</>") + len(tagName(tag))
+	}
+
+	return length
+}
+
+// tagName returns the lower case name of an opening or closing tag, such as a for <a href="...">
+func tagName(tag string) string {
+	name := strings.TrimLeft(strings.TrimPrefix(tag, "<"), "/")
+	end := strings.IndexAny(name, " \t\n/>")
+
+	if end >= 0 {
+		name = name[:end]
+	}
+
+	return strings.ToLower(name)
+}
+
+// messageTokens splits a line into the smallest pieces it can be cut between. For HTML a whole tag or entity is one
+// piece, otherwise each character is.
+func messageTokens(line string, html bool) []string {
+	var tokens []string
+
+	for i := 0; i < len(line); {
+		_, size := utf8.DecodeRuneInString(line[i:])
+		end := i + size
+
+		if html {
+			switch line[i] {
+			case '<':
+				if close := strings.IndexByte(line[i:], '>'); close > 0 {
+					end = i + close + 1
+				}
+			case '&':
+				if semicolon := strings.IndexByte(line[i:], ';'); semicolon > 1 && semicolon <= maxEntityLength && isEntityName(line[i+1:i+semicolon]) {
+					end = i + semicolon + 1
+				}
+			}
+		}
+
+		tokens = append(tokens, line[i:end])
+		i = end
+	}
+
+	return tokens
+}
+
+// The longest entity expected, such as &#x1F98A;
+const maxEntityLength = 10
+
+func isEntityName(name string) bool {
+	for _, r := range name {
+		if r != '#' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func messageLength(message string) int {
+	length := 0
+
+	for _, r := range message {
+		length += utf16.RuneLen(r)
+	}
+
+	return length
+}
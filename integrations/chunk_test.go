@@ -0,0 +1,139 @@
+package integrations
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A small limit, so a few messages are enough to need more than one chunk
+const testMessageLimit = 2000
+
+func rssMessages(count, length int) []string {
+	messages := make([]string, count)
+
+	for i := range messages {
+		messages[i] = strings.Repeat(string(rune('a'+i%26)), length)
+	}
+
+	return messages
+}
+
+func assertChunksFit(t *testing.T, chunks []messageChunk, limit int) {
+	t.Helper()
+
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, messageLength(chunk.text), limit)
+	}
+}
+
+func TestChunkMessagesSingleChunk(t *testing.T) {
+	chunks := chunkMessages([]string{"hello", "world"}, testMessageLimit, false)
+	assert.Equal(t, []messageChunk{{text: "hello\nworld", messages: []int{0, 1}}}, chunks)
+}
+
+func TestChunkMessagesEmpty(t *testing.T) {
+	assert.Empty(t, chunkMessages(nil, testMessageLimit, false))
+}
+
+func TestChunkMessagesDiscordLimit(t *testing.T) {
+	// 30 messages of 150 chars is 4529 chars joined
+	messages := rssMessages(30, 150)
+	chunks := chunkMessages(messages, testMessageLimit, false)
+
+	assertChunksFit(t, chunks, testMessageLimit)
+	assert.Len(t, chunks, 3)
+
+	// Split on message boundaries and in order
+	assert.Equal(t, strings.Join(messages[:13], "\n"), chunks[0].text)
+	assert.Equal(t, []int{13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25}, chunks[1].messages)
+	assert.Equal(t, strings.Join(messages, "\n"), chunks[0].text+"\n"+chunks[1].text+"\n"+chunks[2].text)
+}
+
+func TestChunkMessagesTelegramLimit(t *testing.T) {
+	messages := rssMessages(30, 150)
+	chunks := chunkMessages(messages, telegramMessageLimit, false)
+
+	assertChunksFit(t, chunks, telegramMessageLimit)
+	assert.Len(t, chunks, 2)
+	assert.Equal(t, 27, len(chunks[0].messages))
+}
+
+func TestChunkMessagesCountsUTF16(t *testing.T) {
+	// Each 📰 is two UTF-16 code units, as counted by Telegram
+	messages := []string{strings.Repeat("📰", 2000), strings.Repeat("📰", 100)}
+	chunks := chunkMessages(messages, telegramMessageLimit, false)
+
+	assertChunksFit(t, chunks, telegramMessageLimit)
+	assert.Len(t, chunks, 2)
+}
+
+func TestChunkMessagesSplitsOversizedMessage(t *testing.T) {
+	long := strings.Repeat("line of weather text\n", 200)
+	chunks := chunkMessages([]string{"before", long, "after"}, testMessageLimit, false)
+
+	assertChunksFit(t, chunks, testMessageLimit)
+	assert.Len(t, chunks, 4)
+	assert.Equal(t, "before", chunks[0].text)
+
+	// The oversized message is split on line breaks
+	assert.True(t, strings.HasSuffix(chunks[1].text, "line of weather text"))
+	assert.Equal(t, []int{1}, chunks[1].messages)
+	assert.Equal(t, []int{1, 2}, chunks[3].messages)
+	assert.True(t, strings.HasSuffix(chunks[3].text, "\nafter"))
+}
+
+func TestChunkMessagesSplitsOversizedLine(t *testing.T) {
+	chunks := chunkMessages([]string{strings.Repeat("x", 4500)}, testMessageLimit, false)
+
+	assertChunksFit(t, chunks, testMessageLimit)
+	assert.Len(t, chunks, 3)
+	assert.Equal(t, 500, len(chunks[2].text))
+}
+
+func TestSeparateMessages(t *testing.T) {
+	chunks := separateMessages([]string{"a", "b"})
+
+	assert.Equal(t, []messageChunk{{text: "a", messages: []int{0}}, {text: "b", messages: []int{1}}}, chunks)
+}
+
+func TestChunkMessagesSplitsHTML(t *testing.T) {
+	line := `<b>Headline &amp; more</b> <a href="https://example.com/news">read <i>the article</i></a>`
+	message := "<blockquote>" + strings.Repeat(line, 20) + "</blockquote>"
+	chunks := chunkMessages([]string{message}, 200, true)
+
+	assertChunksFit(t, chunks, 200)
+	assert.Greater(t, len(chunks), 5)
+
+	var rejoined strings.Builder
+
+	for _, chunk := range chunks {
+		tokens := messageTokens(chunk.text, true)
+		splitter := &messageSplitter{html: true}
+
+		// Every tag opened in a chunk is closed in it
+		assert.Empty(t, splitter.openAfter(tokens), chunk.text)
+		assert.True(t, strings.HasPrefix(chunk.text, "<blockquote>"), chunk.text)
+
+		// No tag or entity is cut in two
+		for _, token := range tokens {
+			assert.NotEqual(t, "<", token)
+			assert.NotEqual(t, "&", token)
+		}
+
+		rejoined.WriteString(chunk.text)
+	}
+
+	// Nothing is lost, only the tags around each cut are added
+	text := regexp.MustCompile(`<[^>]+>`).ReplaceAllString(rejoined.String(), "")
+	assert.Equal(t, strings.Repeat("Headline &amp; more read the article", 20), text)
+}
+
+func TestChunkMessagesLeavesMarkdownAlone(t *testing.T) {
+	chunks := chunkMessages([]string{strings.Repeat("a < b & c ", 30)}, 100, false)
+
+	assertChunksFit(t, chunks, 100)
+	assert.Len(t, chunks, 3)
+}
@@ -0,0 +1,78 @@
+package integrations
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type Command struct {
+	Name string
+	// Arguments shown in the help text, e.g. "<task> <duration>"
+	Usage       string
+	Description string
+	// Handler returns the reply to send back to the chat. The context is cancelled if the reply takes too long.
+	Handler func(ctx context.Context, args []string) string
+}
+
+type Commands struct {
+	mu       sync.Mutex
+	commands []Command
+}
+
+func NewCommands() *Commands {
+	return &Commands{}
+}
+
+func (c *Commands) Add(command Command) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.commands = append(c.commands, command)
+}
+
+func (c *Commands) List() []Command {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Command(nil), c.commands...)
+}
+
+// Execute runs a chat message such as "/pause rss 2h". It returns false if the text is not a command.
+func (c *Commands) Execute(ctx context.Context, text string) (string, bool) {
+	fields := strings.Fields(text)
+
+	if len(fields) == 0 || !strings.HasPrefix(fields[0], "/") {
+		return "", false
+	}
+
+	// Telegram appends the bot name to commands in group chats, e.g. /status@FoxBot
+	name, _, _ := strings.Cut(strings.TrimPrefix(fields[0], "/"), "@")
+	name = strings.ToLower(name)
+
+	for _, command := range c.List() {
+		if command.Name == name {
+			return command.Handler(ctx, fields[1:]), true
+		}
+	}
+
+	return c.Help(), true
+}
+
+func (c *Commands) Help() string {
+	var sb strings.Builder
+
+	sb.WriteString("🦊🤖 Commands:")
+
+	for _, command := range c.List() {
+		usage := ""
+		if len(command.Usage) > 0 {
+			usage = " " + command.Usage
+		}
+
+		fmt.Fprintf(&sb, "\n/%s%s - %s", command.Name, usage, command.Description)
+	}
+
+	return sb.String()
+}
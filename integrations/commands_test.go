@@ -0,0 +1,50 @@
+package integrations
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testCommands() *Commands {
+	commands := NewCommands()
+
+	commands.Add(Command{
+		Name:        "pause",
+		Usage:       "<task> <duration>",
+		Description: "Pause a task",
+		Handler: func(_ context.Context, args []string) string {
+			return "paused " + strings.Join(args, " ")
+		},
+	})
+
+	return commands
+}
+
+func TestCommandsExecute(t *testing.T) {
+	reply, ok := testCommands().Execute(t.Context(), "/pause rss 2h")
+	assert.True(t, ok)
+	assert.Equal(t, "paused rss 2h", reply)
+}
+
+func TestCommandsExecuteWithBotName(t *testing.T) {
+	reply, ok := testCommands().Execute(t.Context(), "/Pause@FoxBot weather 1h")
+	assert.True(t, ok)
+	assert.Equal(t, "paused weather 1h", reply)
+}
+
+func TestCommandsExecuteUnknownShowsHelp(t *testing.T) {
+	reply, ok := testCommands().Execute(t.Context(), "/nope")
+	assert.True(t, ok)
+	assert.Equal(t, "🦊🤖 Commands:\n/pause <task> <duration> - Pause a task", reply)
+}
+
+func TestCommandsExecuteIgnoresPlainText(t *testing.T) {
+	_, ok := testCommands().Execute(t.Context(), "hello there")
+	assert.False(t, ok)
+
+	_, ok = testCommands().Execute(t.Context(), "")
+	assert.False(t, ok)
+}
@@ -0,0 +1,33 @@
+package integrations
+
+import (
+	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
+)
+
+type Console struct{}
+
+func NewConsole() *Console {
+	return &Console{}
+}
+
+func (c *Console) Name() string {
+	return "console"
+}
+
+func (c *Console) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (c *Console) Send(message types.Message) {
+	text := FormatPlain(message)
+
+	switch message.Severity {
+	case types.SeverityGood:
+		utils.NotifyConsoleGood(text)
+	case types.SeverityBad:
+		utils.NotifyConsoleBad(text)
+	default:
+		utils.NotifyConsole(text)
+	}
+}
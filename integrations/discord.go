@@ -1,10 +1,18 @@
 package integrations
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/antfie/FoxBot/bayes"
 	"github.com/antfie/FoxBot/db"
 	"github.com/antfie/FoxBot/types"
 	"github.com/antfie/FoxBot/utils"
@@ -12,84 +20,251 @@ import (
 
 type Discord struct {
 	webhookURL string
+	channelID  string
+	headers    map[string]string
 	db         *db.DB
-	duration   *types.TimeDuration
+	bayes      *bayes.Classifier
+	limiter    *rateLimiter
+	queue      *queueProcessor
 }
 
-var discordHeaders = map[string]string{
-	"Content-Type": "application/json",
+// Webhooks allow 5 requests per 2 seconds, but only 30 messages a minute per channel
+const (
+	discordMessagesPerSecond = 0.5
+	discordMessageBurst      = 5
+)
+
+// A message can hold up to 10 embeds, so queued messages are posted ten at a time
+const discordEmbedsPerMessage = 10
+
+const discordAPIBase = "https://discord.com/api/v10"
+
+type discordRateLimitResponse struct {
+	RetryAfter float64 `json:"retry_after"`
 }
 
-func NewDiscord(config *types.Discord, db *db.DB) *Discord {
+func NewDiscord(config *types.Discord, db *db.DB, classifier *bayes.Classifier) *Discord {
 	d := &Discord{
 		webhookURL: config.WebhookURL,
-		db:         db,
-		duration:   config.Duration,
+		channelID:  config.ChannelID,
+		headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		db:      db,
+		bayes:   classifier,
+		limiter: newRateLimiter(discordMessagesPerSecond, discordMessageBurst),
+	}
+
+	if len(config.Token) > 0 {
+		d.headers["Authorization"] = "Bot " + config.Token
 	}
 
-	go d.processor()
+	d.queue = &queueProcessor{
+		channel:   d.Name(),
+		db:        db,
+		duration:  config.Duration,
+		sendBatch: d.notifyEmbeds,
+		batch:     discordEmbedsPerMessage,
+	}
+
+	if d.bot() {
+		d.queue.sendFeedback = d.sendFeedback
+	}
 
 	return d
 }
 
-func (d *Discord) processor() {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+func (d *Discord) Name() string {
+	return "discord"
+}
+
+func (d *Discord) Capabilities() Capabilities {
+	return Capabilities{Buttons: d.bot(), Markdown: true, Push: true}
+}
+
+func (d *Discord) Run(ctx context.Context) {
+	if !d.bot() {
+		d.queue.run(ctx)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Go(func() { d.queue.run(ctx) })
+	wg.Go(func() { d.feedbackProcessor(ctx) })
+	wg.Wait()
+}
+
+func (d *Discord) Flush() {
+	d.queue.flushWithinWindow()
+}
+
+// bot is true when a bot token and channel are configured, which lets FoxBot read reactions for feedback
+func (d *Discord) bot() bool {
+	return len(d.headers["Authorization"]) > 0 && len(d.channelID) > 0
+}
+
+var discordMarkdownReplacer = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "~", `\~`, "`", "\\`", "|", `\|`, ">", `\>`)
+
+// discordEscape escapes markdown in text, leaving URLs alone as Discord does not apply markdown inside them
+func discordEscape(s string) string {
+	words := strings.Split(s, " ")
+
+	for i, word := range words {
+		if !strings.HasPrefix(word, "http://") && !strings.HasPrefix(word, "https://") {
+			words[i] = discordMarkdownReplacer.Replace(word)
+		}
+	}
+
+	return strings.Join(words, " ")
+}
+
+const discordEmbedTitleLimit = 256
+
+type discordEmbed struct {
+	Title       string              `json:"title,omitempty"`
+	URL         string              `json:"url,omitempty"`
+	Description string              `json:"description,omitempty"`
+	Color       int                 `json:"color,omitempty"`
+	Fields      []discordEmbedField `json:"fields,omitempty"`
+	Footer      *discordEmbedFooter `json:"footer,omitempty"`
+}
+
+type discordEmbedField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbedFooter struct {
+	Text string `json:"text"`
+}
+
+// newDiscordEmbed renders a message as an embed, with the source in the footer and the severity as its colour
+func newDiscordEmbed(message types.Message) discordEmbed {
+	title := []rune(strings.TrimSpace(message.Icon + " " + message.Title))
+
+	if len(title) > discordEmbedTitleLimit {
+		title = append(title[:discordEmbedTitleLimit-1], '…')
+	}
+
+	embed := discordEmbed{
+		Title: string(title),
+		URL:   message.Link,
+	}
+
+	var highlights []string
+
+	for _, term := range message.Highlights {
+		highlights = append(highlights, "**"+discordEscape(term)+"**")
+	}
+
+	embed.Description = strings.Join(highlights, ", ")
+
+	switch message.Severity {
+	case types.SeverityGood:
+		embed.Color = 0x2ecc71
+	case types.SeverityBad:
+		embed.Color = 0xe74c3c
+	}
+
+	for _, field := range message.Fields {
+		embed.Fields = append(embed.Fields, discordEmbedField{Name: discordEscape(field.Name), Value: discordEscape(field.Value), Inline: true})
+	}
+
+	if len(message.Source) > 0 {
+		embed.Footer = &discordEmbedFooter{Text: message.Source}
+	}
+
+	return embed
+}
+
+func (d *Discord) Send(message types.Message) {
+	queueMessage(d.db, d.Name(), message)
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			if d.duration != nil && !utils.IsWithinDuration(time.Now(), *d.duration) {
-				continue
-			}
+// notifyEmbeds posts queued messages as one embed each
+func (d *Discord) notifyEmbeds(payloads []string) error {
+	var embeds []discordEmbed
 
-			messages := d.db.ConsumeDiscordNotificationQueue()
+	for _, payload := range payloads {
+		message, ok := queuedMessage(payload)
 
-			if len(messages) > 0 {
-				message := strings.Join(messages, "\n")
-				d.notify(message)
-			}
+		if !ok {
+			embeds = append(embeds, discordEmbed{Description: payload})
+			continue
 		}
+
+		embeds = append(embeds, newDiscordEmbed(message))
 	}
+
+	body, err := json.Marshal(map[string][]discordEmbed{"embeds": embeds})
+
+	if err != nil {
+		return err
+	}
+
+	if d.bot() {
+		_, err = d.api("POST", "/channels/"+d.channelID+"/messages", string(body))
+		return err
+	}
+
+	_, err = d.request("POST", d.webhookURL, string(body))
+
+	return err
+}
+
+// api makes a rate limited call to the Discord REST API as the bot
+func (d *Discord) api(method, path, body string) ([]byte, error) {
+	return d.request(method, discordAPIBase+path, body)
 }
 
-func (d *Discord) notify(message string) {
-	body := strings.NewReader(`{"content":` + jsonEscapeString(message) + `}`)
+func (d *Discord) request(method, url, body string) ([]byte, error) {
+	var result []byte
+
+	err := d.limiter.do(func() error {
+		var err error
+		result, err = d.post(method, url, body)
+		return err
+	})
 
-	response := utils.HttpRequest("POST", d.webhookURL, discordHeaders, body)
+	return result, err
+}
+
+func (d *Discord) post(method, url, body string) ([]byte, error) {
+	response := utils.HttpRequest(method, url, d.headers, strings.NewReader(body))
 
 	if response == nil {
-		log.Print("Could not connect to Discord webhook")
-		return
+		return nil, errors.New("could not connect to Discord")
 	}
 
-	if err := response.Body.Close(); err != nil {
-		log.Print(err)
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		return nil, &rateLimitedError{platform: "Discord", retryAfter: discordRetryAfter(response)}
 	}
+
+	// Webhooks return 204 No Content, the bot API 200 with the message
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, rejectedByStatus(response.StatusCode, fmt.Errorf("discord returned status %s", response.Status))
+	}
+
+	return io.ReadAll(response.Body)
 }
 
-func jsonEscapeString(s string) string {
-	// Use strings.Builder to build a JSON-escaped string
-	var b strings.Builder
-	b.WriteByte('"')
+func discordRetryAfter(response *http.Response) time.Duration {
+	body, err := io.ReadAll(response.Body)
+
+	if err == nil {
+		var result discordRateLimitResponse
 
-	for _, c := range s {
-		switch c {
-		case '"':
-			b.WriteString(`\"`)
-		case '\\':
-			b.WriteString(`\\`)
-		case '\n':
-			b.WriteString(`\n`)
-		case '\r':
-			b.WriteString(`\r`)
-		case '\t':
-			b.WriteString(`\t`)
-		default:
-			b.WriteRune(c)
+		if json.Unmarshal(body, &result) == nil && result.RetryAfter > 0 {
+			return time.Duration(result.RetryAfter * float64(time.Second))
 		}
 	}
 
-	b.WriteByte('"')
-	return b.String()
+	return retryAfterHeader(response)
 }
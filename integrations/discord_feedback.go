@@ -0,0 +1,170 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/antfie/FoxBot/types"
+)
+
+const (
+	discordRelevantEmoji   = "👍"
+	discordIrrelevantEmoji = "👎"
+
+	// Reactions are read by polling the channel's recent messages, which needs no gateway connection
+	discordReactionPollInterval = 30 * time.Second
+	discordReactionPollMessages = 100
+)
+
+type discordReaction struct {
+	Count int  `json:"count"`
+	Me    bool `json:"me"`
+	Emoji struct {
+		Name string `json:"name"`
+	} `json:"emoji"`
+}
+
+type discordMessage struct {
+	ID        string            `json:"id"`
+	Reactions []discordReaction `json:"reactions"`
+}
+
+// SendWithFeedback queues an RSS item to be posted as the bot with 👍/👎 reactions for the user to click
+func (d *Discord) SendWithFeedback(message types.Message, articleHash string) {
+	queueFeedback(d.db, d.Name(), message, articleHash)
+}
+
+func (d *Discord) sendFeedback(message types.Message, articleHash string) error {
+	content, err := json.Marshal(map[string][]discordEmbed{"embeds": {newDiscordEmbed(message)}})
+
+	if err != nil {
+		return err
+	}
+
+	body, err := d.api("POST", "/channels/"+d.channelID+"/messages", string(content))
+
+	if err != nil {
+		return err
+	}
+
+	var sent discordMessage
+
+	// The message has been posted, so log rather than send it again
+	if err = json.Unmarshal(body, &sent); err != nil || len(sent.ID) == 0 {
+		log.Printf("Could not parse Discord message: %v", err)
+		return nil
+	}
+
+	d.db.BayesSaveArticleMessage(articleHash, d.Name(), sent.ID)
+
+	for _, emoji := range []string{discordRelevantEmoji, discordIrrelevantEmoji} {
+		path := "/channels/" + d.channelID + "/messages/" + sent.ID + "/reactions/" + url.PathEscape(emoji) + "/@me"
+
+		if _, err = d.api("PUT", path, ""); err != nil {
+			log.Printf("Could not add Discord reaction: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func (d *Discord) feedbackProcessor(ctx context.Context) {
+	ticker := time.NewTicker(discordReactionPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			d.pollReactions()
+		}
+	}
+}
+
+// pollReactions trains the classifier from reactions on the channel's most recent messages.
+// Removing a reaction undoes the label it gave.
+func (d *Discord) pollReactions() {
+	body, err := d.api("GET", "/channels/"+d.channelID+"/messages?limit="+strconv.Itoa(discordReactionPollMessages), "")
+
+	if err != nil {
+		log.Printf("Could not read Discord reactions: %v", err)
+		return
+	}
+
+	var messages []discordMessage
+
+	if err = json.Unmarshal(body, &messages); err != nil {
+		log.Printf("Could not parse Discord messages: %v", err)
+		return
+	}
+
+	for _, message := range messages {
+		hash := d.db.BayesGetArticleByMessage(d.Name(), message.ID)
+
+		if len(hash) == 0 {
+			continue
+		}
+
+		// Kept in the database so a restart does not apply every reaction again
+		previous, seen := d.db.BayesGetMessageReactionLabel(d.Name(), message.ID)
+		label, ok := reactionLabel(message.Reactions)
+
+		// Both reactions chosen, wait until the user makes up their mind
+		if !ok {
+			continue
+		}
+
+		// No reactions on a message we have not seen before, so leave any label given on another channel alone
+		if label == previous && (seen || len(label) == 0) {
+			if !seen {
+				d.db.BayesSetMessageReactionLabel(d.Name(), message.ID, label)
+			}
+
+			continue
+		}
+
+		d.db.BayesSetMessageReactionLabel(d.Name(), message.ID, label)
+		applyFeedback(d.db, d.bayes, hash, label)
+	}
+}
+
+// reactionLabel works out the label from a message's reactions, ignoring the bot's own.
+// It returns false when both 👍 and 👎 have been chosen.
+func reactionLabel(reactions []discordReaction) (string, bool) {
+	relevant, irrelevant := false, false
+
+	for _, reaction := range reactions {
+		count := reaction.Count
+
+		if reaction.Me {
+			count--
+		}
+
+		if count < 1 {
+			continue
+		}
+
+		switch reaction.Emoji.Name {
+		case discordRelevantEmoji:
+			relevant = true
+		case discordIrrelevantEmoji:
+			irrelevant = true
+		}
+	}
+
+	switch {
+	case relevant && irrelevant:
+		return "", false
+	case relevant:
+		return labelRelevant, true
+	case irrelevant:
+		return labelIrrelevant, true
+	default:
+		return "", true
+	}
+}
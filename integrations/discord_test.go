@@ -0,0 +1,36 @@
+package integrations
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func reaction(emoji string, count int, me bool) discordReaction {
+	r := discordReaction{Count: count, Me: me}
+	r.Emoji.Name = emoji
+	return r
+}
+
+func TestReactionLabel(t *testing.T) {
+	// Only the bot's own reactions
+	label, ok := reactionLabel([]discordReaction{reaction("👍", 1, true), reaction("👎", 1, true)})
+	assert.True(t, ok)
+	assert.Equal(t, "", label)
+
+	label, ok = reactionLabel([]discordReaction{reaction("👍", 2, true), reaction("👎", 1, true)})
+	assert.True(t, ok)
+	assert.Equal(t, labelRelevant, label)
+
+	label, ok = reactionLabel([]discordReaction{reaction("👍", 1, true), reaction("👎", 1, false)})
+	assert.True(t, ok)
+	assert.Equal(t, labelIrrelevant, label)
+
+	// Other emoji are ignored
+	label, ok = reactionLabel([]discordReaction{reaction("🎉", 3, false)})
+	assert.True(t, ok)
+	assert.Equal(t, "", label)
+
+	_, ok = reactionLabel([]discordReaction{reaction("👍", 2, true), reaction("👎", 2, true)})
+	assert.False(t, ok)
+}
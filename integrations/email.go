@@ -0,0 +1,320 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"log"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
+)
+
+// Email sends notifications over SMTP, either a batch at a time or as one digest a day
+type Email struct {
+	host       string
+	port       int
+	security   string
+	username   string
+	password   string
+	sender     string
+	recipients []string
+	subject    string
+	digestAt   *time.Time
+	location   *time.Location
+	duration   *types.TimeDuration
+	db         *db.DB
+}
+
+const (
+	// Polled less often than the chat outputs so a burst of notifications arrives as one email
+	emailPollInterval = time.Minute
+	emailTimeout      = 30 * time.Second
+	// The integration state key holding the day the last digest was sent, as YYYY-MM-DD
+	emailLastDigestKey = "last_digest"
+)
+
+func NewEmail(config *types.Email, db *db.DB) *Email {
+	e := &Email{
+		host:       config.Host,
+		port:       config.Port,
+		security:   config.Security,
+		username:   config.Username,
+		password:   config.Password,
+		sender:     config.Sender,
+		recipients: config.Recipients,
+		subject:    config.Subject,
+		digestAt:   config.DigestAt,
+		location:   config.Location,
+		duration:   config.Duration,
+		db:         db,
+	}
+
+	return e
+}
+
+func (e *Email) Name() string {
+	return "email"
+}
+
+// Capabilities reports Push for immediate mode only, as a digest never interrupts anyone
+func (e *Email) Capabilities() Capabilities {
+	return Capabilities{Markdown: true, Push: e.digestAt == nil}
+}
+
+// Send queues the message as JSON, so the email can be laid out with every message to hand
+func (e *Email) Send(message types.Message) {
+	queueMessage(e.db, e.Name(), message)
+}
+
+// Flush sends anything queued for email. A digest waits for its time rather than going out early.
+func (e *Email) Flush() {
+	if e.digestAt != nil {
+		return
+	}
+
+	e.tick(time.Now())
+}
+
+func (e *Email) Run(ctx context.Context) {
+	ticker := time.NewTicker(emailPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.tick(time.Now())
+		}
+	}
+}
+
+func (e *Email) tick(now time.Time) {
+	if e.digestAt == nil {
+		if e.duration != nil && !utils.IsWithinDuration(now, *e.duration) {
+			return
+		}
+
+		e.flush(now, false)
+		return
+	}
+
+	now = e.digestTime(now)
+
+	if !e.digestDue(now) {
+		return
+	}
+
+	// A failed digest is retried with the next day's rather than straight away
+	e.db.SetIntegrationState(e.Name(), emailLastDigestKey, now.Format(time.DateOnly))
+	e.flush(now, true)
+}
+
+// digestDue is true once the digest time has passed and today's digest has not been sent. The day is kept in the
+// database, so a restart after the digest time sends a missed digest but not one already sent.
+func (e *Email) digestDue(now time.Time) bool {
+	if e.digestAt == nil {
+		return false
+	}
+
+	now = e.digestTime(now)
+
+	if now.Hour()*60+now.Minute() < e.digestAt.Hour()*60+e.digestAt.Minute() {
+		return false
+	}
+
+	return e.db.GetIntegrationState(e.Name(), emailLastDigestKey) != now.Format(time.DateOnly)
+}
+
+// digestTime returns now in the timezone the digest time is given in
+func (e *Email) digestTime(now time.Time) time.Time {
+	if e.location == nil {
+		return now
+	}
+
+	return now.In(e.location)
+}
+
+func (e *Email) flush(now time.Time, digest bool) {
+	notifications := e.db.LeaseNotifications(e.Name(), queueLeaseDuration)
+
+	if len(notifications) == 0 {
+		return
+	}
+
+	var messages []types.Message
+
+	for _, n := range notifications {
+		message, ok := queuedMessage(n.Payload)
+
+		if !ok {
+			message = types.Message{Title: n.Payload, Severity: n.Severity}
+		}
+
+		messages = append(messages, message)
+	}
+
+	subject := e.subject + ": " + utils.Pluralize("notification", len(messages))
+
+	if digest {
+		subject = e.subject + " digest for " + now.Format("Monday 2 January")
+	} else if len(messages) == 1 {
+		subject = e.subject + ": " + messages[0].Title
+	}
+
+	plain, html := emailBody(messages)
+	err := e.deliver(buildEmail(e.sender, e.recipients, subject, plain, html, now))
+
+	if err == nil {
+		e.db.AckNotifications(notifications)
+		return
+	}
+
+	log.Printf("Could not deliver %s to %s: %v", utils.Pluralize("notification", len(notifications)), e.Name(), err)
+	e.db.RetryNotifications(notifications, err.Error(), maxDeliveryAttempts, retryBaseDelay, retryMaxDelay)
+
+	for _, n := range notifications {
+		if n.Attempts >= maxDeliveryAttempts {
+			log.Printf("Giving up on %s notification %d after %d attempts", e.Name(), n.ID, n.Attempts)
+		}
+	}
+}
+
+// deliver sends a message over SMTP with implicit TLS, STARTTLS or no encryption
+func (e *Email) deliver(message []byte) error {
+	address := net.JoinHostPort(e.host, strconv.Itoa(e.port))
+	dialer := &net.Dialer{Timeout: emailTimeout}
+
+	var conn net.Conn
+	var err error
+
+	if e.security == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, e.tlsConfig())
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if err = conn.SetDeadline(time.Now().Add(emailTimeout)); err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, e.host)
+
+	if err != nil {
+		return err
+	}
+
+	if err = e.transmit(client, message); err != nil {
+		if closeErr := client.Close(); closeErr != nil {
+			log.Print(closeErr)
+		}
+
+		return err
+	}
+
+	return client.Quit()
+}
+
+func (e *Email) tlsConfig() *tls.Config {
+	return &tls.Config{ServerName: e.host, MinVersion: tls.VersionTLS12}
+}
+
+func (e *Email) transmit(client *smtp.Client, message []byte) error {
+	if e.security == "starttls" {
+		if err := client.StartTLS(e.tlsConfig()); err != nil {
+			return err
+		}
+	}
+
+	if len(e.username) > 0 {
+		if err := client.Auth(smtp.PlainAuth("", e.username, e.password, e.host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(e.sender); err != nil {
+		return err
+	}
+
+	for _, recipient := range e.recipients {
+		if err := client.Rcpt(recipient); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = writer.Write(message); err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// buildEmail returns a multipart/alternative message with plain text and HTML versions of the body
+func buildEmail(sender string, recipients []string, subject, plain, html string, now time.Time) []byte {
+	var body bytes.Buffer
+	parts := multipart.NewWriter(&body)
+
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", plain},
+		{"text/html; charset=utf-8", html},
+	} {
+		writer, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+
+		if err != nil {
+			log.Print(err)
+			continue
+		}
+
+		encoder := quotedprintable.NewWriter(writer)
+
+		if _, err = encoder.Write([]byte(part.content)); err != nil {
+			log.Print(err)
+		}
+
+		if err = encoder.Close(); err != nil {
+			log.Print(err)
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		log.Print(err)
+	}
+
+	var message bytes.Buffer
+
+	fmt.Fprintf(&message, "From: %s\r\n", sender)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(recipients, ", "))
+	// Collapse any line breaks from message titles so they cannot add headers
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", strings.Join(strings.Fields(subject), " ")))
+	fmt.Fprintf(&message, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+	message.Write(body.Bytes())
+
+	return message.Bytes()
+}
@@ -0,0 +1,97 @@
+package integrations
+
+import (
+	"html"
+	"slices"
+	"strings"
+
+	"github.com/antfie/FoxBot/types"
+)
+
+type emailSection struct {
+	name     string
+	messages []types.Message
+}
+
+var emailHTMLFormat = messageFormat{
+	escape: html.EscapeString,
+	bold:   func(s string) string { return "<b>" + s + "</b>" },
+	link: func(s string) string {
+		return `<a href="` + html.EscapeString(s) + `">` + html.EscapeString(s) + "</a>"
+	},
+}
+
+// emailSections groups messages with weather and countdown first, then other notifications, then RSS items by
+// feed group. Messages keep their order within a section.
+func emailSections(messages []types.Message) []emailSection {
+	var weather, countdown, other []types.Message
+	feedGroups := map[string][]types.Message{}
+
+	for _, message := range messages {
+		switch message.Category {
+		case types.CategoryWeather:
+			weather = append(weather, message)
+		case types.CategoryCountdown:
+			countdown = append(countdown, message)
+		case types.CategoryRSS:
+			feedGroups[message.Group] = append(feedGroups[message.Group], message)
+		default:
+			other = append(other, message)
+		}
+	}
+
+	var sections []emailSection
+
+	for _, section := range []emailSection{{"Weather", weather}, {"Countdown", countdown}, {"Notifications", other}} {
+		if len(section.messages) > 0 {
+			sections = append(sections, section)
+		}
+	}
+
+	var groups []string
+
+	for group := range feedGroups {
+		groups = append(groups, group)
+	}
+
+	slices.Sort(groups)
+
+	for _, group := range groups {
+		name := group
+
+		if len(name) == 0 {
+			name = "RSS"
+		}
+
+		sections = append(sections, emailSection{name, feedGroups[group]})
+	}
+
+	return sections
+}
+
+// emailBody renders the plain text and HTML versions of an email
+func emailBody(messages []types.Message) (string, string) {
+	var plain, body strings.Builder
+
+	body.WriteString(`<html><body style="font-family: sans-serif">`)
+
+	for i, section := range emailSections(messages) {
+		if i > 0 {
+			plain.WriteString("\n")
+		}
+
+		plain.WriteString(section.name + "\n" + strings.Repeat("=", len([]rune(section.name))) + "\n")
+		body.WriteString("<h2>" + html.EscapeString(section.name) + "</h2><ul>")
+
+		for _, message := range section.messages {
+			plain.WriteString(FormatPlain(message) + "\n")
+			body.WriteString("<li>" + strings.ReplaceAll(emailHTMLFormat.render(message), "\n", "<br>") + "</li>")
+		}
+
+		body.WriteString("</ul>")
+	}
+
+	body.WriteString("</body></html>")
+
+	return plain.String(), body.String()
+}
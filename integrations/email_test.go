@@ -0,0 +1,153 @@
+package integrations
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpSink is a minimal SMTP server that accepts one message and hands back what it received
+func smtpSink(t *testing.T) (string, int, <-chan string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	received := make(chan string, 1)
+
+	go func() {
+		defer listener.Close()
+
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+		var data strings.Builder
+
+		reply("220 localhost")
+
+		for {
+			line, err := reader.ReadString('\n')
+
+			if err != nil {
+				return
+			}
+
+			command := strings.ToUpper(strings.TrimSpace(line))
+
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case command == "DATA":
+				reply("354 go ahead")
+
+				for {
+					line, err = reader.ReadString('\n')
+
+					if err != nil || line == ".\r\n" {
+						break
+					}
+
+					data.WriteString(line)
+				}
+
+				received <- data.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	assert.NoError(t, err)
+
+	portNumber, err := strconv.Atoi(port)
+	assert.NoError(t, err)
+
+	return host, portNumber, received
+}
+
+func TestEmailDeliver(t *testing.T) {
+	host, port, received := smtpSink(t)
+
+	e := &Email{host: host, port: port, security: "none", sender: "foxbot@example.com", recipients: []string{"me@example.com"}}
+	plain, html := emailBody([]types.Message{{Title: "Hello <world>"}})
+
+	err := e.deliver(buildEmail(e.sender, e.recipients, "FoxBot:\r\nBcc: x@example.com", plain, html, time.Now()))
+	assert.NoError(t, err)
+
+	message := <-received
+	assert.Contains(t, message, "Subject: FoxBot: Bcc: x@example.com\r\n")
+	assert.Contains(t, message, "Content-Type: multipart/alternative")
+	assert.Contains(t, message, "Hello <world>")
+	assert.Contains(t, message, "Hello &lt;world&gt;")
+}
+
+func TestEmailSections(t *testing.T) {
+	sections := emailSections([]types.Message{
+		{Title: "Tech 1", Category: types.CategoryRSS, Group: "Tech"},
+		{Title: "Reminder"},
+		{Title: "News 1", Category: types.CategoryRSS, Group: "News"},
+		{Title: "Sunny", Category: types.CategoryWeather},
+		{Title: "Tech 2", Category: types.CategoryRSS, Group: "Tech"},
+		{Title: "Holiday", Category: types.CategoryCountdown},
+	})
+
+	var names []string
+
+	for _, section := range sections {
+		names = append(names, section.name)
+	}
+
+	assert.Equal(t, []string{"Weather", "Countdown", "Notifications", "News", "Tech"}, names)
+	assert.Equal(t, "Tech 2", sections[4].messages[1].Title)
+}
+
+func TestEmailDigestDue(t *testing.T) {
+	at := time.Date(0, 1, 1, 18, 0, 0, 0, time.UTC)
+	e := &Email{digestAt: &at, db: db.NewDB(":memory:")}
+
+	assert.False(t, e.digestDue(time.Date(2026, 1, 2, 17, 59, 0, 0, time.UTC)))
+	assert.True(t, e.digestDue(time.Date(2026, 1, 2, 18, 0, 0, 0, time.UTC)))
+
+	// Sent today, which survives a restart as it is kept in the database
+	e.tick(time.Date(2026, 1, 2, 18, 0, 0, 0, time.UTC))
+	assert.Equal(t, "2026-01-02", e.db.GetIntegrationState("email", emailLastDigestKey))
+	assert.False(t, e.digestDue(time.Date(2026, 1, 2, 23, 0, 0, 0, time.UTC)))
+	assert.True(t, e.digestDue(time.Date(2026, 1, 3, 18, 30, 0, 0, time.UTC)))
+}
+
+func TestEmailDigestDueInTimezone(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+
+	// 08:00 in New York, which is 13:00 UTC in January
+	at := time.Date(0, 1, 1, 8, 0, 0, 0, time.UTC)
+	e := &Email{digestAt: &at, location: location, db: db.NewDB(":memory:")}
+
+	assert.False(t, e.digestDue(time.Date(2026, 1, 2, 12, 59, 0, 0, time.UTC)))
+	assert.True(t, e.digestDue(time.Date(2026, 1, 2, 13, 0, 0, 0, time.UTC)))
+
+	// The day is New York's too, so 02:00 UTC the next day is still the day the digest was sent
+	e.tick(time.Date(2026, 1, 2, 13, 0, 0, 0, time.UTC))
+	assert.Equal(t, "2026-01-02", e.db.GetIntegrationState("email", emailLastDigestKey))
+	assert.False(t, e.digestDue(time.Date(2026, 1, 3, 2, 0, 0, 0, time.UTC)))
+	assert.True(t, e.digestDue(time.Date(2026, 1, 3, 13, 0, 0, 0, time.UTC)))
+}
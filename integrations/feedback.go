@@ -0,0 +1,77 @@
+package integrations
+
+import (
+	"log"
+
+	"github.com/antfie/FoxBot/bayes"
+	"github.com/antfie/FoxBot/db"
+)
+
+const (
+	labelRelevant   = "relevant"
+	labelIrrelevant = "irrelevant"
+)
+
+// parseFeedback parses button data such as "r:abc123" into the article hash and the chosen label.
+// The prefix is r for relevant, i for irrelevant and u for undo, which returns an empty label.
+func parseFeedback(data string) (hash, label string, ok bool) {
+	if len(data) < 3 || data[1] != ':' {
+		return "", "", false
+	}
+
+	switch data[0] {
+	case 'r':
+		label = labelRelevant
+	case 'i':
+		label = labelIrrelevant
+	case 'u':
+		label = ""
+	default:
+		return "", "", false
+	}
+
+	return data[2:], label, true
+}
+
+// applyFeedback labels an article and trains the classifier, untraining any previous label first.
+// An empty label undoes the previous label. It returns false if nothing changed.
+func applyFeedback(db *db.DB, classifier *bayes.Classifier, hash, label string) bool {
+	feedGroup, title, currentLabel, found := db.BayesGetArticle(hash)
+
+	if !found {
+		log.Printf("Bayes article not found for hash: %s", hash)
+		return false
+	}
+
+	// Same button pressed again — ignore duplicate
+	if currentLabel == label {
+		if len(label) > 0 {
+			log.Printf("Bayes [%s] duplicate %s ignored: %s", feedGroup, label, title)
+		}
+
+		return false
+	}
+
+	// Changed mind or undo — untrain old label first
+	if len(currentLabel) > 0 {
+		classifier.Untrain(feedGroup, title, currentLabel == labelRelevant)
+	}
+
+	switch {
+	case len(label) == 0:
+		log.Printf("Bayes [%s] undid %s: %s", feedGroup, currentLabel, title)
+	case len(currentLabel) > 0:
+		log.Printf("Bayes [%s] changed %s -> %s: %s", feedGroup, currentLabel, label, title)
+	default:
+		log.Printf("Bayes [%s] trained as %s: %s", feedGroup, label, title)
+	}
+
+	// Train with new label
+	if len(label) > 0 {
+		classifier.Train(feedGroup, title, label == labelRelevant)
+	}
+
+	db.BayesSetArticleLabel(hash, label)
+
+	return true
+}
@@ -0,0 +1,96 @@
+package integrations
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/antfie/FoxBot/types"
+)
+
+// messageFormat describes a channel's markup, used to render a types.Message as text
+type messageFormat struct {
+	escape func(string) string
+	bold   func(string) string
+	link   func(string) string
+}
+
+var plainFormat = messageFormat{
+	escape: func(s string) string { return s },
+	bold:   func(s string) string { return s },
+	link:   func(s string) string { return s },
+}
+
+// FormatPlain renders a message without any markup, for the console and logs
+func FormatPlain(message types.Message) string {
+	return plainFormat.render(message)
+}
+
+// render lays a message out as "📰 [Source]: Title - Link", followed by a line per field
+func (f messageFormat) render(message types.Message) string {
+	var b strings.Builder
+
+	if len(message.Icon) > 0 {
+		b.WriteString(message.Icon + " ")
+	}
+
+	if len(message.Source) > 0 {
+		b.WriteString("[" + f.escape(message.Source) + "]: ")
+	}
+
+	b.WriteString(f.title(message))
+
+	if len(message.Link) > 0 {
+		b.WriteString(" - " + f.link(message.Link))
+	}
+
+	for _, field := range message.Fields {
+		b.WriteString("\n" + f.bold(f.escape(field.Name)) + ": " + f.escape(field.Value))
+	}
+
+	return b.String()
+}
+
+// title emphasises the highlighted terms in the title, and appends any that the title does not contain
+func (f messageFormat) title(message types.Message) string {
+	title := message.Title
+	var missing []string
+	var matches [][]int
+
+	for _, term := range message.Highlights {
+		termMatches := highlightPattern(term).FindAllStringIndex(title, -1)
+
+		if len(termMatches) == 0 {
+			missing = append(missing, term)
+		}
+
+		matches = append(matches, termMatches...)
+	}
+
+	var b strings.Builder
+	position := 0
+
+	slices.SortFunc(matches, func(a, b []int) int { return a[0] - b[0] })
+
+	for _, match := range matches {
+		if match[0] < position {
+			continue
+		}
+
+		b.WriteString(f.escape(title[position:match[0]]))
+		b.WriteString(f.bold(f.escape(title[match[0]:match[1]])))
+		position = match[1]
+	}
+
+	b.WriteString(f.escape(title[position:]))
+
+	for _, term := range missing {
+		b.WriteString(" " + f.bold(f.escape(term)))
+	}
+
+	return b.String()
+}
+
+func highlightPattern(term string) *regexp.Regexp {
+	return regexp.MustCompile(`(?i)\b` + regexp.QuoteMeta(term) + `\b`)
+}
@@ -0,0 +1,52 @@
+package integrations
+
+import (
+	"testing"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var rssMessage = types.Message{
+	Icon:       "📰 🚨",
+	Title:      "Ransomware hits R&D <labs>",
+	Link:       "https://example.com/a_b?x=1&y=2",
+	Source:     "News:Example",
+	Highlights: []string{"ransomware"},
+}
+
+func TestFormatPlain(t *testing.T) {
+	assert.Equal(t, "📰 🚨 [News:Example]: Ransomware hits R&D <labs> - https://example.com/a_b?x=1&y=2", FormatPlain(rssMessage))
+	assert.Equal(t, "Hello", FormatPlain(types.Message{Title: "Hello"}))
+}
+
+func TestFormatPerChannel(t *testing.T) {
+	assert.Equal(t, "📰 🚨 [News:Example]: *Ransomware* hits R&amp;D &lt;labs&gt; - <https://example.com/a_b?x=1&y=2>", slackFormat.render(rssMessage))
+	assert.Equal(t, "📰 🚨 [News:Example]: <b>Ransomware</b> hits R&amp;D &lt;labs&gt; - https://example.com/a_b?x=1&amp;y=2", telegramFormat.render(rssMessage))
+}
+
+func TestFormatHighlights(t *testing.T) {
+	// Terms found in the body rather than the title are shown after it
+	message := types.Message{Title: "Breaking: data breach", Highlights: []string{"breach", "leak"}}
+	assert.Equal(t, "Breaking: data *breach* *leak*", slackFormat.render(message))
+
+	// Only whole words are highlighted
+	message = types.Message{Title: "Hacker news", Highlights: []string{"hack"}}
+	assert.Equal(t, "Hacker news *hack*", slackFormat.render(message))
+
+	message = types.Message{Title: "Weather", Fields: []types.MessageField{{Name: "Wind", Value: "5 mph"}}}
+	assert.Equal(t, "Weather\n<b>Wind</b>: 5 mph", telegramFormat.render(message))
+}
+
+func TestDiscordEmbed(t *testing.T) {
+	embed := newDiscordEmbed(types.Message{Icon: "📰", Title: "Hello", Link: "https://example.com", Source: "News", Highlights: []string{"a_b"}, Severity: types.SeverityBad})
+
+	assert.Equal(t, "📰 Hello", embed.Title)
+	assert.Equal(t, "https://example.com", embed.URL)
+	assert.Equal(t, `**a\_b**`, embed.Description)
+	assert.Equal(t, 0xe74c3c, embed.Color)
+	assert.Equal(t, "News", embed.Footer.Text)
+
+	embed = newDiscordEmbed(types.Message{Title: "Manchester", Fields: []types.MessageField{{Name: "Rain", Value: "65% *chance*"}}})
+	assert.Equal(t, []discordEmbedField{{Name: "Rain", Value: `65% \*chance\*`, Inline: true}}, embed.Fields)
+}
@@ -0,0 +1,112 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+)
+
+// Gotify pushes each notification to a Gotify server as an application, see https://gotify.net/api-docs
+type Gotify struct {
+	url     string
+	headers map[string]string
+	db      *db.DB
+	limiter *rateLimiter
+	queue   *queueProcessor
+}
+
+const (
+	gotifyMessagesPerSecond = 5
+	gotifyMessageBurst      = 10
+)
+
+type gotifyMessage struct {
+	Title    string         `json:"title"`
+	Message  string         `json:"message"`
+	Priority int            `json:"priority"`
+	Extras   map[string]any `json:"extras,omitempty"`
+}
+
+func NewGotify(config *types.Gotify, db *db.DB) *Gotify {
+	g := &Gotify{
+		url: strings.TrimRight(config.Server, "/") + "/message",
+		headers: map[string]string{
+			"Content-Type": "application/json",
+			"X-Gotify-Key": config.Token,
+		},
+		db:      db,
+		limiter: newRateLimiter(gotifyMessagesPerSecond, gotifyMessageBurst),
+	}
+
+	g.queue = &queueProcessor{
+		channel:  g.Name(),
+		db:       db,
+		duration: config.Duration,
+		send:     g.notify,
+	}
+
+	return g
+}
+
+func (g *Gotify) Name() string {
+	return "gotify"
+}
+
+func (g *Gotify) Capabilities() Capabilities {
+	return Capabilities{Push: true}
+}
+
+func (g *Gotify) Run(ctx context.Context) {
+	g.queue.run(ctx)
+}
+
+func (g *Gotify) Flush() {
+	g.queue.flushWithinWindow()
+}
+
+func (g *Gotify) Send(message types.Message) {
+	body, err := json.Marshal(gotifyPayload(message))
+
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	g.db.QueueNotification(g.Name(), message.Severity, string(body))
+}
+
+// gotifyPayload maps severity to priority. The Android app only makes a sound from priority 4 and pops up from 8.
+func gotifyPayload(message types.Message) gotifyMessage {
+	payload := gotifyMessage{
+		Title:    pushTitle(message),
+		Message:  pushText(message),
+		Priority: 4,
+	}
+
+	switch message.Severity {
+	case types.SeverityGood:
+		payload.Priority = 7
+	case types.SeverityBad:
+		payload.Priority = 9
+	}
+
+	if len(message.Link) > 0 {
+		payload.Extras = map[string]any{
+			"client::notification": map[string]any{
+				"click": map[string]string{"url": message.Link},
+			},
+		}
+	}
+
+	return payload
+}
+
+func (g *Gotify) notify(body string) error {
+	return g.limiter.do(func() error {
+		return deliverHTTP(g.Name(), "POST", g.url, g.headers, body)
+	})
+}
@@ -0,0 +1,224 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/antfie/FoxBot/bayes"
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
+)
+
+// Matrix sends notifications to a room with the client-server API, and trains the classifier from reactions
+type Matrix struct {
+	apiBase string
+	roomID  string
+	headers map[string]string
+	db      *db.DB
+	bayes   *bayes.Classifier
+	limiter *rateLimiter
+	// Makes transaction IDs unique within this run, the timestamp makes them unique across runs
+	transactions atomic.Int64
+	// Our own user, so FoxBot's own reactions are not taken as feedback
+	userID string
+	queue  *queueProcessor
+}
+
+// Synapse allows a message every 5 seconds per user with a burst of 10 by default
+const (
+	matrixMessagesPerSecond = 0.2
+	matrixMessageBurst      = 10
+)
+
+type matrixResponse struct {
+	EventID      string `json:"event_id"`
+	UserID       string `json:"user_id"`
+	ErrCode      string `json:"errcode"`
+	Error        string `json:"error"`
+	RetryAfterMs int64  `json:"retry_after_ms"`
+}
+
+var matrixFormat = messageFormat{
+	escape: html.EscapeString,
+	bold:   func(s string) string { return "<b>" + s + "</b>" },
+	link: func(s string) string {
+		return `<a href="` + html.EscapeString(s) + `">` + html.EscapeString(s) + "</a>"
+	},
+}
+
+func NewMatrix(config *types.Matrix, db *db.DB, classifier *bayes.Classifier) *Matrix {
+	m := &Matrix{
+		apiBase: strings.TrimRight(config.Homeserver, "/") + "/_matrix/client/v3",
+		roomID:  config.RoomID,
+		headers: map[string]string{
+			"Content-Type":  "application/json",
+			"Authorization": "Bearer " + config.AccessToken,
+		},
+		db:      db,
+		bayes:   classifier,
+		limiter: newRateLimiter(matrixMessagesPerSecond, matrixMessageBurst),
+	}
+
+	m.queue = &queueProcessor{
+		channel:      m.Name(),
+		db:           db,
+		duration:     config.Duration,
+		limit:        matrixMessageLimit,
+		html:         true,
+		render:       htmlRenderer(matrixFormat),
+		send:         m.notify,
+		sendFeedback: m.sendFeedback,
+	}
+
+	return m
+}
+
+func (m *Matrix) Name() string {
+	return "matrix"
+}
+
+func (m *Matrix) Capabilities() Capabilities {
+	return Capabilities{Buttons: true, Markdown: true, Push: true}
+}
+
+func (m *Matrix) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Go(func() { m.queue.run(ctx) })
+	wg.Go(func() { m.feedbackProcessor(ctx) })
+	wg.Wait()
+}
+
+func (m *Matrix) Flush() {
+	m.queue.flushWithinWindow()
+}
+
+// Send queues the message as HTML, the plain text body is worked out from it when the batch is sent
+func (m *Matrix) Send(message types.Message) {
+	queueMessage(m.db, m.Name(), message)
+}
+
+func (m *Matrix) notify(message string) error {
+	_, err := m.sendEvent("m.room.message", matrixTextContent(message))
+
+	return err
+}
+
+// SendWithFeedback queues an RSS item to be sent with 👍/👎 reactions
+func (m *Matrix) SendWithFeedback(message types.Message, articleHash string) {
+	queueFeedback(m.db, m.Name(), message, articleHash)
+}
+
+func (m *Matrix) sendFeedback(message types.Message, articleHash string) error {
+	eventID, err := m.sendEvent("m.room.message", matrixTextContent(matrixFormat.render(message)))
+
+	if err != nil {
+		return err
+	}
+
+	m.db.BayesSaveArticleMessage(articleHash, m.Name(), eventID)
+
+	// React first so the user only has to click
+	for _, emoji := range []string{matrixRelevantKey, matrixIrrelevantKey} {
+		content := map[string]any{
+			"m.relates_to": map[string]string{"rel_type": "m.annotation", "event_id": eventID, "key": emoji},
+		}
+
+		if _, err = m.sendEvent("m.reaction", content); err != nil {
+			log.Printf("Could not add Matrix reaction: %v", err)
+		}
+	}
+
+	return nil
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// matrixTextContent is an m.text message with our HTML as the formatted body and a plain text fallback
+func matrixTextContent(formatted string) map[string]any {
+	plain := html.UnescapeString(htmlTag.ReplaceAllString(formatted, ""))
+
+	return map[string]any{
+		"msgtype":        "m.text",
+		"body":           plain,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": strings.ReplaceAll(formatted, "\n", "<br>"),
+	}
+}
+
+// sendEvent sends an event to the room and returns its ID
+func (m *Matrix) sendEvent(eventType string, content any) (string, error) {
+	body, err := json.Marshal(content)
+
+	if err != nil {
+		return "", err
+	}
+
+	// The same transaction ID is used if the request is retried, so the homeserver will not send it twice
+	transactionID := fmt.Sprintf("foxbot.%d.%d", time.Now().UnixNano(), m.transactions.Add(1))
+	path := "/rooms/" + url.PathEscape(m.roomID) + "/send/" + eventType + "/" + transactionID
+
+	var result matrixResponse
+
+	err = m.limiter.do(func() error {
+		var err error
+		result, err = m.request("PUT", m.apiBase+path, string(body))
+		return err
+	})
+
+	return result.EventID, err
+}
+
+func (m *Matrix) request(method, requestURL, body string) (matrixResponse, error) {
+	var result matrixResponse
+
+	response := utils.HttpRequest(method, requestURL, m.headers, strings.NewReader(body))
+
+	if response == nil {
+		return result, errors.New("could not connect to Matrix homeserver")
+	}
+
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	responseBody, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		return result, err
+	}
+
+	if err = json.Unmarshal(responseBody, &result); err != nil {
+		return result, fmt.Errorf("could not parse Matrix response (status %s): %v", response.Status, err)
+	}
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		retryAfter := defaultRetryAfter
+
+		if result.RetryAfterMs > 0 {
+			retryAfter = time.Duration(result.RetryAfterMs) * time.Millisecond
+		}
+
+		return result, &rateLimitedError{platform: "Matrix", retryAfter: retryAfter}
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return result, rejectedByStatus(response.StatusCode, fmt.Errorf("matrix returned %s: %s %s", response.Status, result.ErrCode, result.Error))
+	}
+
+	return result, nil
+}
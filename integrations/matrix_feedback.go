@@ -0,0 +1,216 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/antfie/FoxBot/utils"
+)
+
+const (
+	matrixRelevantKey   = "👍"
+	matrixIrrelevantKey = "👎"
+
+	matrixLongPollTimeout = 30 * time.Second
+	matrixPollMinBackoff  = time.Second
+	matrixPollMaxBackoff  = 5 * time.Minute
+)
+
+type matrixEvent struct {
+	Type    string `json:"type"`
+	EventID string `json:"event_id"`
+	Sender  string `json:"sender"`
+	Redacts string `json:"redacts"`
+	Content struct {
+		RelatesTo struct {
+			RelType string `json:"rel_type"`
+			EventID string `json:"event_id"`
+			Key     string `json:"key"`
+		} `json:"m.relates_to"`
+		// Room version 11 moved redacts into the content
+		Redacts string `json:"redacts"`
+	} `json:"content"`
+}
+
+type matrixSyncResponse struct {
+	NextBatch string `json:"next_batch"`
+	ErrCode   string `json:"errcode"`
+	Error     string `json:"error"`
+	Rooms     struct {
+		Join map[string]struct {
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+	} `json:"rooms"`
+}
+
+func (m *Matrix) feedbackProcessor(ctx context.Context) {
+	backoff := matrixPollMinBackoff
+
+	for ctx.Err() == nil {
+		err := m.pollFeedback(ctx)
+
+		if err == nil {
+			backoff = matrixPollMinBackoff
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Matrix sync failed, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, matrixPollMaxBackoff)
+	}
+}
+
+// pollFeedback long polls /sync for reactions and redactions in the room. The first sync only records where the
+// room is up to, so reactions from before FoxBot started are not replayed.
+func (m *Matrix) pollFeedback(ctx context.Context) error {
+	if len(m.userID) == 0 {
+		whoami, err := m.request("GET", m.apiBase+"/account/whoami", "")
+
+		if err != nil {
+			return err
+		}
+
+		m.userID = whoami.UserID
+	}
+
+	filter := fmt.Sprintf(`{"presence":{"types":[]},"account_data":{"types":[]},"room":{"rooms":[%q],"state":{"types":[]},"ephemeral":{"types":[]},"account_data":{"types":[]},"timeline":{"types":["m.reaction","m.room.redaction"],"limit":100}}}`, m.roomID)
+	since := m.db.GetIntegrationState(m.Name(), "next_batch")
+	timeout := matrixLongPollTimeout
+
+	requestURL := m.apiBase + "/sync?filter=" + url.QueryEscape(filter)
+
+	if len(since) > 0 {
+		requestURL += "&since=" + url.QueryEscape(since)
+	} else {
+		timeout = 0
+	}
+
+	requestURL += fmt.Sprintf("&timeout=%d", timeout.Milliseconds())
+
+	// Allow the server to hold the request for the full long poll timeout
+	response, err := utils.HttpRequestOnce(ctx, "GET", requestURL, m.headers, nil, timeout+10*time.Second)
+
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	body, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		return fmt.Errorf("could not read response: %v", err)
+	}
+
+	var result matrixSyncResponse
+
+	if err = json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("could not parse response (status %s): %v", response.Status, err)
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("matrix returned %s: %s %s", response.Status, result.ErrCode, result.Error)
+	}
+
+	if len(since) > 0 {
+		for _, event := range result.Rooms.Join[m.roomID].Timeline.Events {
+			m.processEvent(event)
+		}
+	}
+
+	m.db.SetIntegrationState(m.Name(), "next_batch", result.NextBatch)
+
+	return nil
+}
+
+func (m *Matrix) processEvent(event matrixEvent) {
+	if event.Sender == m.userID {
+		return
+	}
+
+	if event.Type == "m.room.redaction" {
+		m.processRedaction(event)
+		return
+	}
+
+	target, label, ok := matrixReactionFeedback(event)
+
+	if !ok {
+		return
+	}
+
+	hash := m.db.BayesGetArticleByMessage(m.Name(), target)
+
+	if len(hash) == 0 {
+		return
+	}
+
+	// Kept so removing the reaction undoes the label, even after a restart
+	m.db.BayesSaveArticleReaction(m.Name(), event.EventID, hash, label)
+	applyFeedback(m.db, m.bayes, hash, label)
+}
+
+// processRedaction undoes a label when its reaction is removed, unless the article has been relabelled since
+func (m *Matrix) processRedaction(event matrixEvent) {
+	redacts := event.Redacts
+
+	if len(redacts) == 0 {
+		redacts = event.Content.Redacts
+	}
+
+	hash, label, found := m.db.BayesTakeArticleReaction(m.Name(), redacts)
+
+	if !found {
+		return
+	}
+
+	_, _, currentLabel, found := m.db.BayesGetArticle(hash)
+
+	if found && currentLabel == label {
+		applyFeedback(m.db, m.bayes, hash, "")
+	}
+}
+
+// matrixReactionFeedback returns the event a 👍/👎 reaction was added to and the label it gives
+func matrixReactionFeedback(event matrixEvent) (target, label string, ok bool) {
+	relatesTo := event.Content.RelatesTo
+
+	if event.Type != "m.reaction" || relatesTo.RelType != "m.annotation" {
+		return "", "", false
+	}
+
+	// Element sends reactions with a variation selector
+	switch strings.TrimSuffix(relatesTo.Key, "\ufe0f") {
+	case matrixRelevantKey:
+		label = labelRelevant
+	case matrixIrrelevantKey:
+		label = labelIrrelevant
+	default:
+		return "", "", false
+	}
+
+	return relatesTo.EventID, label, true
+}
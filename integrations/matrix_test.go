@@ -0,0 +1,65 @@
+package integrations
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/antfie/FoxBot/bayes"
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMatrixTextContent(t *testing.T) {
+	formatted := matrixFormat.render(types.Message{Title: "R&D news", Link: "https://example.com/?a=1&b=2", Highlights: []string{"news"}}) + "\nSecond"
+	content := matrixTextContent(formatted)
+
+	assert.Equal(t, "R&D news - https://example.com/?a=1&b=2\nSecond", content["body"])
+	assert.Equal(t, `R&amp;D <b>news</b> - <a href="https://example.com/?a=1&amp;b=2">https://example.com/?a=1&amp;b=2</a><br>Second`, content["formatted_body"])
+}
+
+func parseMatrixEvent(t *testing.T, data string) matrixEvent {
+	t.Helper()
+
+	var event matrixEvent
+	assert.NoError(t, json.Unmarshal([]byte(data), &event))
+
+	return event
+}
+
+func TestMatrixReactionFeedback(t *testing.T) {
+	target, label, ok := matrixReactionFeedback(parseMatrixEvent(t, `{"type":"m.reaction","content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$abc","key":"👍"}}}`))
+	assert.True(t, ok)
+	assert.Equal(t, "$abc", target)
+	assert.Equal(t, labelRelevant, label)
+
+	// Element adds a variation selector
+	_, label, ok = matrixReactionFeedback(parseMatrixEvent(t, `{"type":"m.reaction","content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$abc","key":"👎️"}}}`))
+	assert.True(t, ok)
+	assert.Equal(t, labelIrrelevant, label)
+
+	_, _, ok = matrixReactionFeedback(parseMatrixEvent(t, `{"type":"m.reaction","content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$abc","key":"🎉"}}}`))
+	assert.False(t, ok)
+
+	_, _, ok = matrixReactionFeedback(parseMatrixEvent(t, `{"type":"m.room.message","content":{"body":"👍"}}`))
+	assert.False(t, ok)
+}
+
+func TestMatrixRedactionAfterRestart(t *testing.T) {
+	database := db.NewDB(":memory:")
+	database.BayesSaveArticle("abc123", "News", "A headline")
+	database.BayesSaveArticleMessage("abc123", "matrix", "$message")
+
+	m := &Matrix{db: database, bayes: bayes.NewClassifier(database), userID: "@foxbot:example.org"}
+	m.processEvent(parseMatrixEvent(t, `{"type":"m.reaction","event_id":"$reaction","sender":"@user:example.org","content":{"m.relates_to":{"rel_type":"m.annotation","event_id":"$message","key":"👎"}}}`))
+
+	_, _, label, _ := database.BayesGetArticle("abc123")
+	assert.Equal(t, labelIrrelevant, label)
+
+	// A new instance has nothing in memory, so the reaction must come from the database
+	m = &Matrix{db: database, bayes: bayes.NewClassifier(database), userID: "@foxbot:example.org"}
+	m.processEvent(parseMatrixEvent(t, `{"type":"m.room.redaction","event_id":"$redaction","sender":"@user:example.org","redacts":"$reaction"}`))
+
+	_, _, label, _ = database.BayesGetArticle("abc123")
+	assert.Equal(t, "", label)
+}
@@ -0,0 +1,117 @@
+package integrations
+
+import (
+	"context"
+	"sync"
+
+	"github.com/antfie/FoxBot/types"
+)
+
+type Capabilities struct {
+	// Buttons means RSS items can be sent with 👍/👎 feedback buttons
+	Buttons bool
+	// Markdown means the channel renders formatting such as bold text
+	Markdown bool
+	// Push means the channel pings a device, so keyword_only feed groups only send keyword matches
+	Push bool
+}
+
+type Notifier interface {
+	Name() string
+	Capabilities() Capabilities
+	Send(message types.Message)
+}
+
+// FeedbackNotifier is implemented by notifiers that report Capabilities.Buttons
+type FeedbackNotifier interface {
+	Notifier
+	SendWithFeedback(message types.Message, articleHash string)
+}
+
+// Flusher is implemented by outputs that hold notifications in an outbox, so they can be sent before FoxBot stops
+type Flusher interface {
+	// Flush sends what is queued now, unless the output is outside its from/to window
+	Flush()
+}
+
+// Runner is implemented by outputs with work to do in the background, such as draining their outbox or polling for
+// feedback
+type Runner interface {
+	// Run works until the context is cancelled, and returns once everything it started has finished
+	Run(ctx context.Context)
+}
+
+// Registry sits between the tasks and the outputs, passing each notification to the outputs whose routes match it
+type Registry struct {
+	notifiers []Notifier
+	// The routes of each notifier, by index
+	routes  [][]types.Route
+	running sync.WaitGroup
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds an output. With no routes it receives every notification.
+func (r *Registry) Register(notifier Notifier, routes []types.Route) {
+	r.notifiers = append(r.notifiers, notifier)
+	r.routes = append(r.routes, routes)
+}
+
+// Notifiers returns every output, whatever its routes
+func (r *Registry) Notifiers() []Notifier {
+	return r.notifiers
+}
+
+// Routed returns the outputs that should receive the message
+func (r *Registry) Routed(message types.Message) []Notifier {
+	var routed []Notifier
+
+	for i, n := range r.notifiers {
+		if routesMatch(r.routes[i], message) {
+			routed = append(routed, n)
+		}
+	}
+
+	return routed
+}
+
+func (r *Registry) Notify(message types.Message) {
+	for _, n := range r.Routed(message) {
+		n.Send(message)
+	}
+}
+
+// Start runs each output's background work until the context is cancelled
+func (r *Registry) Start(ctx context.Context) {
+	for _, n := range r.notifiers {
+		if runner, ok := n.(Runner); ok {
+			r.running.Go(func() { runner.Run(ctx) })
+		}
+	}
+}
+
+// Wait returns once the background work started by Start has stopped, so nothing is left writing to the database
+func (r *Registry) Wait() {
+	r.running.Wait()
+}
+
+// Flush sends whatever the outputs have queued and are allowed to send now
+func (r *Registry) Flush() {
+	for _, n := range r.notifiers {
+		if f, ok := n.(Flusher); ok {
+			f.Flush()
+		}
+	}
+}
+
+func (r *Registry) HasFeedback() bool {
+	for _, n := range r.notifiers {
+		if n.Capabilities().Buttons {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,135 @@
+package integrations
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+)
+
+// Ntfy publishes each notification to a ntfy topic, see https://docs.ntfy.sh/publish/#publish-as-json
+type Ntfy struct {
+	server  string
+	topic   string
+	headers map[string]string
+	db      *db.DB
+	limiter *rateLimiter
+	queue   *queueProcessor
+}
+
+// ntfy.sh allows a burst of 60 messages, then one every 5 seconds
+const (
+	ntfyMessagesPerSecond = 0.2
+	ntfyMessageBurst      = 60
+)
+
+type ntfyMessage struct {
+	Topic    string   `json:"topic"`
+	Title    string   `json:"title,omitempty"`
+	Message  string   `json:"message"`
+	Priority int      `json:"priority"`
+	Click    string   `json:"click,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+func NewNtfy(config *types.Ntfy, db *db.DB) *Ntfy {
+	n := &Ntfy{
+		server: strings.TrimRight(config.Server, "/"),
+		topic:  config.Topic,
+		headers: map[string]string{
+			"Content-Type": "application/json",
+		},
+		db:      db,
+		limiter: newRateLimiter(ntfyMessagesPerSecond, ntfyMessageBurst),
+	}
+
+	if len(config.Token) > 0 {
+		n.headers["Authorization"] = "Bearer " + config.Token
+	}
+
+	n.queue = &queueProcessor{
+		channel:  n.Name(),
+		db:       db,
+		duration: config.Duration,
+		send:     n.notify,
+	}
+
+	return n
+}
+
+func (n *Ntfy) Name() string {
+	return "ntfy"
+}
+
+func (n *Ntfy) Capabilities() Capabilities {
+	return Capabilities{Push: true}
+}
+
+func (n *Ntfy) Run(ctx context.Context) {
+	n.queue.run(ctx)
+}
+
+func (n *Ntfy) Flush() {
+	n.queue.flushWithinWindow()
+}
+
+// Send queues the JSON to publish, as each notification is its own push with its own click URL
+func (n *Ntfy) Send(message types.Message) {
+	body, err := json.Marshal(ntfyPayload(n.topic, message))
+
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	n.db.QueueNotification(n.Name(), message.Severity, string(body))
+}
+
+func ntfyPayload(topic string, message types.Message) ntfyMessage {
+	payload := ntfyMessage{
+		Topic:    topic,
+		Title:    pushTitle(message),
+		Message:  pushText(message),
+		Priority: 3,
+		Click:    message.Link,
+	}
+
+	switch message.Severity {
+	case types.SeverityGood:
+		payload.Priority = 4
+	case types.SeverityBad:
+		payload.Priority = 5
+	}
+
+	if len(message.Group) > 0 {
+		payload.Tags = []string{message.Group}
+	}
+
+	return payload
+}
+
+// pushTitle is the source of a message, such as the feed, which push apps show above the text
+func pushTitle(message types.Message) string {
+	if len(message.Source) > 0 {
+		return message.Source
+	}
+
+	return "FoxBot"
+}
+
+// pushText renders a message without the source and link, which push apps show separately
+func pushText(message types.Message) string {
+	message.Source = ""
+	message.Link = ""
+
+	return FormatPlain(message)
+}
+
+func (n *Ntfy) notify(body string) error {
+	return n.limiter.do(func() error {
+		return deliverHTTP(n.Name(), "POST", n.server, n.headers, body)
+	})
+}
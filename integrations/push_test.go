@@ -0,0 +1,49 @@
+package integrations
+
+import (
+	"testing"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var pushRSSMessage = types.Message{
+	Icon:       "📰 🚨",
+	Title:      "Big news",
+	Link:       "https://example.com/news",
+	Source:     "News:Example",
+	Group:      "News",
+	Highlights: []string{"big"},
+	Severity:   types.SeverityGood,
+}
+
+func TestNtfyPayload(t *testing.T) {
+	payload := ntfyPayload("foxbot", pushRSSMessage)
+
+	assert.Equal(t, ntfyMessage{
+		Topic:    "foxbot",
+		Title:    "News:Example",
+		Message:  "📰 🚨 Big news",
+		Priority: 4,
+		Click:    "https://example.com/news",
+		Tags:     []string{"News"},
+	}, payload)
+
+	payload = ntfyPayload("foxbot", types.Message{Title: "RSS feed has failed", Severity: types.SeverityBad})
+	assert.Equal(t, "FoxBot", payload.Title)
+	assert.Equal(t, 5, payload.Priority)
+	assert.Empty(t, payload.Click)
+	assert.Empty(t, payload.Tags)
+}
+
+func TestGotifyPayload(t *testing.T) {
+	payload := gotifyPayload(pushRSSMessage)
+
+	assert.Equal(t, "News:Example", payload.Title)
+	assert.Equal(t, 7, payload.Priority)
+	assert.Equal(t, map[string]any{"click": map[string]string{"url": "https://example.com/news"}}, payload.Extras["client::notification"])
+
+	payload = gotifyPayload(types.Message{Title: "Hello"})
+	assert.Equal(t, 4, payload.Priority)
+	assert.Nil(t, payload.Extras)
+}
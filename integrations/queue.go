@@ -0,0 +1,327 @@
+package integrations
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
+)
+
+const (
+	queuePollInterval   = 5 * time.Second
+	queueLeaseDuration  = 5 * time.Minute
+	maxDeliveryAttempts = 8
+	retryBaseDelay      = 30 * time.Second
+	retryMaxDelay       = time.Hour
+)
+
+// queueMessage holds a message in the outbox as JSON, for outputs that lay it out once they have the whole batch
+func queueMessage(db *db.DB, channel string, message types.Message) {
+	payload, err := json.Marshal(message)
+
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	db.QueueNotification(channel, message.Severity, string(payload))
+}
+
+// queuedMessage reads a message held by queueMessage. It returns false for plain text, such as a row queued by an
+// older version.
+func queuedMessage(payload string) (types.Message, bool) {
+	var message types.Message
+
+	if err := json.Unmarshal([]byte(payload), &message); err != nil {
+		return types.Message{}, false
+	}
+
+	return message, true
+}
+
+// htmlRenderer renders payloads from queueMessage in an HTML format. Anything else is plain text queued by an older
+// version, which is escaped so that a link such as <https://example.com> is not read as a tag.
+func htmlRenderer(format messageFormat) func(payload string) string {
+	return func(payload string) string {
+		message, ok := queuedMessage(payload)
+
+		if !ok {
+			return html.EscapeString(payload)
+		}
+
+		return format.render(message)
+	}
+}
+
+// rejectedError is returned by a send when the platform refused the request with a 4xx other than 429. Sending the
+// same message again fails the same way, so a batch is not held up by it.
+type rejectedError struct {
+	err error
+}
+
+func (e *rejectedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *rejectedError) Unwrap() error {
+	return e.err
+}
+
+// rejectedByStatus marks err as a rejection when the status is a 4xx other than 429
+func rejectedByStatus(status int, err error) error {
+	if status >= http.StatusBadRequest && status < http.StatusInternalServerError && status != http.StatusTooManyRequests {
+		return &rejectedError{err: err}
+	}
+
+	return err
+}
+
+// queueFeedback holds an RSS item in the outbox, to be sent with its feedback buttons once the output's window opens
+func queueFeedback(db *db.DB, channel string, message types.Message, articleHash string) {
+	payload, err := json.Marshal(message)
+
+	if err != nil {
+		log.Print(err)
+		return
+	}
+
+	db.QueueFeedbackNotification(channel, message.Severity, string(payload), articleHash)
+}
+
+// queueProcessor drains a channel's outbox. Notifications are only acknowledged once send reports success,
+// otherwise they are retried with backoff and eventually dead-lettered.
+type queueProcessor struct {
+	channel  string
+	db       *db.DB
+	duration *types.TimeDuration
+	// The platform's maximum message length, batches are split to fit. Zero sends each message on its own.
+	limit int
+	// HTML means messages are only split between tags and entities
+	html bool
+	send func(message string) error
+	// Renders a payload as the text given to send, for outputs that queue with queueMessage. Without it the payload
+	// is sent as it is.
+	render func(payload string) string
+	// Used instead of send by outputs that post several messages at once as embeds or blocks, rather than as
+	// joined text. It is given up to batch payloads from queueMessage.
+	sendBatch func(payloads []string) error
+	batch     int
+	// Sends an RSS item with feedback buttons, for outputs that train the classifier
+	sendFeedback func(message types.Message, articleHash string) error
+}
+
+func (q *queueProcessor) run(ctx context.Context) {
+	ticker := time.NewTicker(queuePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			q.flushWithinWindow()
+		}
+	}
+}
+
+// flushWithinWindow sends the outbox unless the output is outside its window, where it is left for later
+func (q *queueProcessor) flushWithinWindow() {
+	if q.duration != nil && !utils.IsWithinDuration(time.Now(), *q.duration) {
+		return
+	}
+
+	q.flush()
+}
+
+func (q *queueProcessor) flush() {
+	notifications := q.db.LeaseNotifications(q.channel, queueLeaseDuration)
+
+	if len(notifications) == 0 {
+		return
+	}
+
+	var feedback []types.QueuedNotification
+
+	notifications = slices.DeleteFunc(notifications, func(n types.QueuedNotification) bool {
+		if len(n.ArticleHash) == 0 {
+			return false
+		}
+
+		feedback = append(feedback, n)
+		return true
+	})
+
+	q.flushMessages(notifications)
+	q.flushFeedback(feedback)
+}
+
+func (q *queueProcessor) flushMessages(notifications []types.QueuedNotification) {
+	if len(notifications) == 0 {
+		return
+	}
+
+	var payloads []string
+
+	for _, n := range notifications {
+		if !slices.Contains(payloads, n.Payload) {
+			payloads = append(payloads, n.Payload)
+		}
+	}
+
+	// Why each message was not sent in full, nil once it has been
+	failures := make([]error, len(payloads))
+	// A failure that is not down to the message, such as the platform being down, leaves the rest for the next attempt
+	var stopped error
+	var rejected *rejectedError
+
+	for _, chunk := range q.chunks(payloads) {
+		err := stopped
+
+		if err == nil {
+			err = q.sendChunk(payloads, chunk)
+		}
+
+		if stopped == nil && errors.As(err, &rejected) && len(chunk.messages) > 1 {
+			// One bad message gets the whole post rejected, so the rest of the batch is sent a message at a time
+			for _, i := range chunk.messages {
+				err := stopped
+
+				if err == nil {
+					err = q.sendAll(payloads[i : i+1])
+				}
+
+				if err != nil && !errors.As(err, &rejected) {
+					stopped = err
+				}
+
+				failures[i] = cmp.Or(failures[i], err)
+			}
+
+			continue
+		}
+
+		if err != nil && !errors.As(err, &rejected) {
+			stopped = err
+		}
+
+		for _, i := range chunk.messages {
+			failures[i] = cmp.Or(failures[i], err)
+		}
+	}
+
+	var acknowledged []types.QueuedNotification
+	var reasons []error
+	failed := map[string][]types.QueuedNotification{}
+
+	for _, n := range notifications {
+		err := failures[slices.Index(payloads, n.Payload)]
+
+		if err == nil {
+			acknowledged = append(acknowledged, n)
+			continue
+		}
+
+		if _, found := failed[err.Error()]; !found {
+			reasons = append(reasons, err)
+		}
+
+		failed[err.Error()] = append(failed[err.Error()], n)
+	}
+
+	q.db.AckNotifications(acknowledged)
+
+	for _, err := range reasons {
+		q.retry(failed[err.Error()], err)
+	}
+}
+
+// chunks groups payloads into posts, in order
+func (q *queueProcessor) chunks(payloads []string) []messageChunk {
+	if q.sendBatch != nil {
+		return batchMessages(payloads, q.batch)
+	}
+
+	messages := payloads
+
+	if q.render != nil {
+		messages = make([]string, len(payloads))
+
+		for i, payload := range payloads {
+			messages[i] = q.render(payload)
+		}
+	}
+
+	if q.limit > 0 {
+		return chunkMessages(messages, q.limit, q.html)
+	}
+
+	return separateMessages(messages)
+}
+
+func (q *queueProcessor) sendChunk(payloads []string, chunk messageChunk) error {
+	if q.sendBatch != nil {
+		return q.sendBatch(payloads[chunk.messages[0] : chunk.messages[len(chunk.messages)-1]+1])
+	}
+
+	return q.send(chunk.text)
+}
+
+// sendAll sends payloads in as many posts as they need, stopping at the first failure
+func (q *queueProcessor) sendAll(payloads []string) error {
+	for _, chunk := range q.chunks(payloads) {
+		if err := q.sendChunk(payloads, chunk); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushFeedback sends each RSS item held back while the output was outside its window, as every one needs its own buttons
+func (q *queueProcessor) flushFeedback(notifications []types.QueuedNotification) {
+	for i, n := range notifications {
+		var message types.Message
+		err := json.Unmarshal([]byte(n.Payload), &message)
+
+		if err == nil {
+			if q.sendFeedback == nil {
+				err = fmt.Errorf("%s does not support feedback", q.channel)
+			} else {
+				err = q.sendFeedback(message, n.ArticleHash)
+			}
+		}
+
+		if err != nil {
+			// Keep the remaining items in order behind the one that failed
+			q.retry(notifications[i:], err)
+			return
+		}
+
+		q.db.AckNotifications(notifications[i : i+1])
+	}
+}
+
+func (q *queueProcessor) retry(failed []types.QueuedNotification, err error) {
+	if len(failed) == 0 {
+		return
+	}
+
+	log.Printf("Could not deliver %s to %s: %v", utils.Pluralize("notification", len(failed)), q.channel, err)
+	q.db.RetryNotifications(failed, err.Error(), maxDeliveryAttempts, retryBaseDelay, retryMaxDelay)
+
+	for _, n := range failed {
+		if n.Attempts >= maxDeliveryAttempts {
+			log.Printf("Giving up on %s notification %d after %d attempts", q.channel, n.ID, n.Attempts)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package integrations
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlushSendsQueuedFeedbackWithButtons(t *testing.T) {
+	database := db.NewDB(":memory:")
+
+	var sent []string
+	var feedback []string
+
+	q := &queueProcessor{
+		channel: "telegram",
+		db:      database,
+		send: func(message string) error {
+			sent = append(sent, message)
+			return nil
+		},
+		sendFeedback: func(message types.Message, articleHash string) error {
+			feedback = append(feedback, articleHash+" "+message.Title)
+			return nil
+		},
+	}
+
+	database.QueueNotification("telegram", types.SeverityInfo, "Reminder")
+	queueFeedback(database, "telegram", types.Message{Title: "First"}, "aaa")
+	queueFeedback(database, "telegram", types.Message{Title: "Second"}, "bbb")
+
+	q.flush()
+
+	assert.Equal(t, []string{"Reminder"}, sent)
+	assert.Equal(t, []string{"aaa First", "bbb Second"}, feedback)
+	assert.Empty(t, database.LeaseNotifications("telegram", 0))
+}
+
+func TestFlushRetriesFeedbackInOrder(t *testing.T) {
+	database := db.NewDB(":memory:")
+
+	var feedback []string
+
+	q := &queueProcessor{
+		channel: "telegram",
+		db:      database,
+		sendFeedback: func(message types.Message, articleHash string) error {
+			if articleHash == "bbb" {
+				return errors.New("boom")
+			}
+
+			feedback = append(feedback, articleHash)
+			return nil
+		},
+	}
+
+	queueFeedback(database, "telegram", types.Message{Title: "First"}, "aaa")
+	queueFeedback(database, "telegram", types.Message{Title: "Second"}, "bbb")
+	queueFeedback(database, "telegram", types.Message{Title: "Third"}, "ccc")
+
+	q.flush()
+
+	// The items after the failure wait behind it rather than being sent out of order
+	assert.Equal(t, []string{"aaa"}, feedback)
+
+	database.Exec("UPDATE notification_outbox SET next_attempt_at = CURRENT_TIMESTAMP")
+
+	var pending []string
+
+	for _, n := range database.LeaseNotifications("telegram", 0) {
+		pending = append(pending, n.ArticleHash)
+	}
+
+	assert.Equal(t, []string{"bbb", "ccc"}, pending)
+}
+
+func TestFlushSendsBatches(t *testing.T) {
+	database := db.NewDB(":memory:")
+
+	var batches [][]string
+
+	q := &queueProcessor{
+		channel: "discord",
+		db:      database,
+		batch:   2,
+		sendBatch: func(payloads []string) error {
+			var titles []string
+
+			for _, payload := range payloads {
+				message, ok := queuedMessage(payload)
+				assert.True(t, ok)
+				titles = append(titles, message.Title)
+			}
+
+			if slices.Contains(titles, "Fourth") {
+				return errors.New("boom")
+			}
+
+			batches = append(batches, titles)
+			return nil
+		},
+	}
+
+	for _, title := range []string{"First", "Second", "Third", "Fourth", "Fifth"} {
+		queueMessage(database, "discord", types.Message{Title: title})
+	}
+
+	q.flush()
+
+	assert.Equal(t, [][]string{{"First", "Second"}}, batches)
+
+	// Everything from the failed batch on is retried
+	database.Exec("UPDATE notification_outbox SET next_attempt_at = CURRENT_TIMESTAMP")
+	assert.Len(t, database.LeaseNotifications("discord", 0), 3)
+}
+
+func TestHtmlRendererEscapesOldPlainText(t *testing.T) {
+	render := htmlRenderer(telegramFormat)
+
+	assert.Equal(t, "[News:Feed]: A &amp; B - &lt;https://example.com&gt;", render("[News:Feed]: A & B - <https://example.com>"))
+
+	payload, err := json.Marshal(types.Message{Title: "A & B", Source: "News"})
+	assert.NoError(t, err)
+	assert.Equal(t, "[News]: A &amp; B", render(string(payload)))
+}
+
+func TestFlushSendsRejectedBatchOneAtATime(t *testing.T) {
+	database := db.NewDB(":memory:")
+
+	var sent []string
+
+	q := &queueProcessor{
+		channel: "telegram",
+		db:      database,
+		limit:   telegramMessageLimit,
+		html:    true,
+		render:  htmlRenderer(telegramFormat),
+		send: func(message string) error {
+			if strings.Contains(message, "Bad") {
+				return &rejectedError{err: errors.New("telegram returned error: Bad Request")}
+			}
+
+			sent = append(sent, message)
+			return nil
+		},
+	}
+
+	queueMessage(database, "telegram", types.Message{Title: "First"})
+	queueMessage(database, "telegram", types.Message{Title: "Bad"})
+	queueMessage(database, "telegram", types.Message{Title: "Third"})
+
+	q.flush()
+
+	// The rejected message does not take the others down with it
+	assert.Equal(t, []string{"First", "Third"}, sent)
+
+	database.Exec("UPDATE notification_outbox SET next_attempt_at = CURRENT_TIMESTAMP")
+	pending := database.LeaseNotifications("telegram", 0)
+
+	if assert.Len(t, pending, 1) {
+		message, _ := queuedMessage(pending[0].Payload)
+		assert.Equal(t, "Bad", message.Title)
+	}
+}
+
+func TestSendWithFeedbackQueues(t *testing.T) {
+	database := db.NewDB(":memory:")
+
+	// No API or limiter is needed, as nothing is sent until the outbox is flushed
+	telegram := &Telegram{db: database}
+	telegram.SendWithFeedback(types.Message{Title: "Breaking"}, "aaa")
+
+	pending := database.LeaseNotifications("telegram", 0)
+
+	if assert.Len(t, pending, 1) {
+		assert.Equal(t, "aaa", pending[0].ArticleHash)
+	}
+}
@@ -0,0 +1,138 @@
+package integrations
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// How many times a send is retried after being told to back off before it is left to the queue's retry
+	maxRateLimitedAttempts = 3
+	// Longer Retry-After waits are not slept through, the queue retries the batch later instead
+	maxRetryAfterWait = time.Minute
+	// Used when a platform rate limits us without saying for how long
+	defaultRetryAfter = time.Second
+)
+
+// rateLimitedError is returned by a send when the platform responded with 429 Too Many Requests
+type rateLimitedError struct {
+	platform   string
+	retryAfter time.Duration
+}
+
+func (e *rateLimitedError) Error() string {
+	return fmt.Sprintf("%s rate limited, retry after %s", e.platform, e.retryAfter)
+}
+
+// rateLimiter is a token bucket shared by all sends to one channel, so bursts drain at the platform's allowed rate
+type rateLimiter struct {
+	mu          sync.Mutex
+	perSecond   float64
+	burst       float64
+	tokens      float64
+	updated     time.Time
+	pausedUntil time.Time
+	// The platform that asked for the pause
+	pausedBy string
+}
+
+func newRateLimiter(perSecond float64, burst int) *rateLimiter {
+	return &rateLimiter{
+		perSecond: perSecond,
+		burst:     float64(burst),
+		tokens:    float64(burst),
+		updated:   time.Now(),
+	}
+}
+
+// do calls send once a token is available, honouring any Retry-After the platform responds with
+func (l *rateLimiter) do(send func() error) error {
+	var err error
+
+	for range maxRateLimitedAttempts {
+		// Still paused by an earlier long Retry-After, so leave it to the queue rather than blocking the caller
+		if wait, platform := l.paused(time.Now()); wait > maxRetryAfterWait {
+			return &rateLimitedError{platform: platform, retryAfter: wait}
+		}
+
+		time.Sleep(l.reserve(time.Now()))
+
+		err = send()
+
+		var rateLimited *rateLimitedError
+
+		if !errors.As(err, &rateLimited) {
+			return err
+		}
+
+		l.pause(time.Now(), rateLimited.retryAfter, rateLimited.platform)
+
+		if rateLimited.retryAfter > maxRetryAfterWait {
+			return err
+		}
+	}
+
+	return err
+}
+
+// reserve takes a token and returns how long the caller must wait before using it
+func (l *rateLimiter) reserve(now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.After(l.updated) {
+		l.tokens = min(l.burst, l.tokens+now.Sub(l.updated).Seconds()*l.perSecond)
+		l.updated = now
+	}
+
+	l.tokens--
+
+	wait := time.Duration(0)
+
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.perSecond * float64(time.Second))
+	}
+
+	return max(wait, l.pausedUntil.Sub(now))
+}
+
+// paused returns how much longer sends are paused for, and by which platform
+func (l *rateLimiter) paused(now time.Time) (time.Duration, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return max(l.pausedUntil.Sub(now), 0), l.pausedBy
+}
+
+func (l *rateLimiter) pause(now time.Time, duration time.Duration, platform string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := now.Add(duration)
+
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+		l.pausedBy = platform
+	}
+
+	// Don't let a burst through the moment the pause ends
+	l.tokens = min(l.tokens, 0)
+}
+
+func retryAfterHeader(response *http.Response) time.Duration {
+	value := response.Header.Get("Retry-After")
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0)
+	}
+
+	return defaultRetryAfter
+}
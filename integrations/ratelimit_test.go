@@ -0,0 +1,87 @@
+package integrations
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimiterAllowsBurst(t *testing.T) {
+	l := newRateLimiter(1, 3)
+	now := l.updated
+
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+
+	// Burst used up, so each further message waits for the bucket to refill
+	assert.Equal(t, time.Second, l.reserve(now))
+	assert.Equal(t, 2*time.Second, l.reserve(now))
+}
+
+func TestRateLimiterRefills(t *testing.T) {
+	l := newRateLimiter(0.5, 1)
+	now := l.updated
+
+	assert.Equal(t, time.Duration(0), l.reserve(now))
+	assert.Equal(t, 2*time.Second, l.reserve(now))
+
+	// Four seconds later both reserved tokens have been earned back
+	assert.Equal(t, time.Duration(0), l.reserve(now.Add(4*time.Second)))
+}
+
+func TestRateLimiterPause(t *testing.T) {
+	l := newRateLimiter(1, 3)
+	now := l.updated
+
+	l.pause(now, 30*time.Second, "Test")
+
+	assert.Equal(t, 30*time.Second, l.reserve(now))
+	assert.Equal(t, 20*time.Second, l.reserve(now.Add(10*time.Second)))
+}
+
+func TestRateLimiterDoGivesUpOnLongRetryAfter(t *testing.T) {
+	l := newRateLimiter(1, 3)
+	calls := 0
+
+	err := l.do(func() error {
+		calls++
+		return &rateLimitedError{platform: "Test", retryAfter: time.Hour}
+	})
+
+	var rateLimited *rateLimitedError
+	assert.True(t, errors.As(err, &rateLimited))
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, time.Hour, l.pausedUntil.Sub(time.Now()).Round(time.Hour))
+}
+
+func TestRateLimiterDoReturnsAtOnceWhilePaused(t *testing.T) {
+	l := newRateLimiter(1, 3)
+	l.pause(time.Now(), time.Hour, "Test")
+	calls := 0
+
+	started := time.Now()
+
+	err := l.do(func() error {
+		calls++
+		return nil
+	})
+
+	var rateLimited *rateLimitedError
+	assert.True(t, errors.As(err, &rateLimited))
+	assert.Equal(t, "Test", rateLimited.platform)
+	assert.Equal(t, time.Hour, rateLimited.retryAfter.Round(time.Hour))
+	assert.Equal(t, 0, calls)
+	assert.Less(t, time.Since(started), time.Second)
+}
+
+func TestRetryAfterHeader(t *testing.T) {
+	response := &http.Response{Header: http.Header{}}
+	assert.Equal(t, defaultRetryAfter, retryAfterHeader(response))
+
+	response.Header.Set("Retry-After", "7")
+	assert.Equal(t, 7*time.Second, retryAfterHeader(response))
+}
@@ -0,0 +1,94 @@
+package integrations
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+// replayFixtures answers every request from testdata/fixtures, so the chat APIs can be tested without the network
+func replayFixtures(t *testing.T) {
+	t.Helper()
+
+	previous := utils.SetHttpClient(utils.NewReplayClient(types.Http{}, "testdata/fixtures"))
+	t.Cleanup(func() { utils.SetHttpClient(previous) })
+}
+
+func TestTelegramSendMessage(t *testing.T) {
+	replayFixtures(t)
+
+	telegram := &Telegram{
+		chatID:  "1000",
+		apiBase: "https://api.telegram.org/bot123456:TEST-token",
+		limiter: newRateLimiter(telegramMessagesPerSecond, telegramMessageBurst),
+	}
+
+	id, err := telegram.sendMessage(url.Values{"chat_id": {"1000"}, "text": {"Hello"}})
+	assert.NoError(t, err)
+	assert.Equal(t, 42, id)
+
+	telegram.apiBase = "https://api.telegram.org/botREVOKED"
+	err = telegram.notify("Hello")
+	assert.EqualError(t, err, "telegram returned error: Unauthorized")
+
+	var rejected *rejectedError
+	assert.ErrorAs(t, err, &rejected)
+}
+
+func TestTelegramFlushesQueue(t *testing.T) {
+	replayFixtures(t)
+
+	database := db.NewDB(":memory:")
+
+	telegram := &Telegram{
+		chatID:  "1000",
+		apiBase: "https://api.telegram.org/bot123456:TEST-token",
+		limiter: newRateLimiter(telegramMessagesPerSecond, telegramMessageBurst),
+	}
+
+	q := &queueProcessor{
+		channel: "telegram",
+		db:      database,
+		limit:   telegramMessageLimit,
+		send:    telegram.notify,
+	}
+
+	database.QueueNotification("telegram", types.SeverityInfo, "First")
+	database.QueueNotification("telegram", types.SeverityGood, "Second")
+
+	q.flush()
+
+	// Failed sends wait to be retried, so clear that to see what is left
+	database.Exec("UPDATE notification_outbox SET next_attempt_at = CURRENT_TIMESTAMP")
+	assert.Empty(t, database.LeaseNotifications("telegram", 0))
+
+	// A rejected send stays queued
+	telegram.apiBase = "https://api.telegram.org/botREVOKED"
+	database.QueueNotification("telegram", types.SeverityInfo, "Third")
+
+	q.flush()
+
+	database.Exec("UPDATE notification_outbox SET next_attempt_at = CURRENT_TIMESTAMP")
+	assert.Len(t, database.LeaseNotifications("telegram", 0), 1)
+}
+
+func TestSlackNotify(t *testing.T) {
+	replayFixtures(t)
+
+	slack := &Slack{
+		channelID: "C000",
+		headers:   map[string]string{"Authorization": "Bearer xoxb-test"},
+		limiter:   newRateLimiter(slackMessagesPerSecond, slackMessageBurst),
+	}
+
+	result, err := slack.api("chat.postMessage", url.Values{"channel": {"C000"}, "text": {"Hello"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "1704096000.000100", result.TS)
+
+	// Queued messages go out as blocks, including plain text queued by an older version
+	assert.NoError(t, slack.notifyBlocks([]string{`{"Title":"Hello"}`, "Plain"}))
+}
@@ -0,0 +1,42 @@
+package integrations
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/antfie/FoxBot/types"
+)
+
+// routesMatch is true when any route matches the message, or there are no routes
+func routesMatch(routes []types.Route, message types.Message) bool {
+	if len(routes) == 0 {
+		return true
+	}
+
+	for _, route := range routes {
+		if routeMatches(route, message) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// routeMatches is true when the message matches every list in the route. Empty lists match anything.
+func routeMatches(route types.Route, message types.Message) bool {
+	if len(route.Tasks) > 0 && !slices.Contains(route.Tasks, message.Category) {
+		return false
+	}
+
+	if len(route.Groups) > 0 && !slices.ContainsFunc(route.Groups, func(group string) bool {
+		return strings.EqualFold(group, message.Group)
+	}) {
+		return false
+	}
+
+	if len(route.Severities) > 0 && !slices.Contains(route.Severities, message.Severity) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,83 @@
+package integrations
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingNotifier struct {
+	name     string
+	received []string
+}
+
+func (n *recordingNotifier) Name() string {
+	return n.name
+}
+
+func (n *recordingNotifier) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (n *recordingNotifier) Send(message types.Message) {
+	n.received = append(n.received, message.Title)
+}
+
+func TestRegistryRoutes(t *testing.T) {
+	discord := &recordingNotifier{name: "discord"}
+	slack := &recordingNotifier{name: "slack"}
+	telegram := &recordingNotifier{name: "telegram"}
+
+	registry := NewRegistry()
+	registry.Register(discord, []types.Route{{Tasks: []string{types.CategoryRSS}, Groups: []string{"Security"}, Severities: []types.Severity{types.SeverityBad}}})
+	registry.Register(slack, []types.Route{{Tasks: []string{types.CategoryWeather}}, {Tasks: []string{types.CategoryCountdown}}})
+	registry.Register(telegram, nil)
+
+	registry.Notify(types.Message{Title: "security alert", Category: types.CategoryRSS, Group: "security", Severity: types.SeverityBad})
+	registry.Notify(types.Message{Title: "security news", Category: types.CategoryRSS, Group: "Security"})
+	registry.Notify(types.Message{Title: "sunny", Category: types.CategoryWeather})
+	registry.Notify(types.Message{Title: "holiday", Category: types.CategoryCountdown})
+	registry.Notify(types.Message{Title: "started", Category: types.CategoryFoxBot})
+
+	assert.Equal(t, []string{"security alert"}, discord.received)
+	assert.Equal(t, []string{"sunny", "holiday"}, slack.received)
+	assert.Equal(t, []string{"security alert", "security news", "sunny", "holiday", "started"}, telegram.received)
+	assert.Len(t, registry.Notifiers(), 3)
+}
+
+// runningNotifier has background work, which takes a moment to stop once cancelled
+type runningNotifier struct {
+	recordingNotifier
+	stopped atomic.Bool
+}
+
+func (n *runningNotifier) Run(ctx context.Context) {
+	<-ctx.Done()
+	time.Sleep(10 * time.Millisecond)
+	n.stopped.Store(true)
+}
+
+func TestRegistryWaitsForRunners(t *testing.T) {
+	matrix := &runningNotifier{recordingNotifier: recordingNotifier{name: "matrix"}}
+
+	registry := NewRegistry()
+	registry.Register(matrix, nil)
+	registry.Register(&recordingNotifier{name: "console"}, nil)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	registry.Start(ctx)
+	cancel()
+	registry.Wait()
+
+	assert.True(t, matrix.stopped.Load())
+}
+
+func TestRouteMatchesEmptyListsMatchAnything(t *testing.T) {
+	assert.True(t, routeMatches(types.Route{}, types.Message{Category: types.CategoryRSS}))
+	assert.True(t, routeMatches(types.Route{Severities: []types.Severity{types.SeverityGood}}, types.Message{Category: types.CategorySiteChanges, Severity: types.SeverityGood}))
+	assert.False(t, routeMatches(types.Route{Groups: []string{"News"}}, types.Message{Category: types.CategoryWeather}))
+}
@@ -1,75 +1,327 @@
 package integrations
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/antfie/FoxBot/bayes"
 	"github.com/antfie/FoxBot/db"
 	"github.com/antfie/FoxBot/types"
 	"github.com/antfie/FoxBot/utils"
+	"io"
 	"log"
+	"net/http"
 	"net/url"
+	"slices"
 	"strings"
-	"time"
+	"sync"
 )
 
 type Slack struct {
-	url      string
-	db       *db.DB
-	duration *types.TimeDuration
+	channelID     string
+	headers       map[string]string
+	signingSecret string
+	listenAddress string
+	db            *db.DB
+	bayes         *bayes.Classifier
+	limiter       *rateLimiter
+	queue         *queueProcessor
+	// Button presses are trained on after replying to Slack, so they are waited for when stopping
+	actionsRunning sync.WaitGroup
 }
 
-var slackHeaders = map[string]string{
-	"Content-Type": "application/x-www-form-urlencoded",
+// chat.postMessage allows about one message per second per channel, with short bursts
+const (
+	slackMessagesPerSecond = 1
+	slackMessageBurst      = 3
+)
+
+// A message can hold up to 50 blocks, and each queued message is one section
+const slackBlocksPerMessage = 50
+
+const slackAPIBase = "https://slack.com/api/"
+
+// Slack reports errors with a 200, these are the ones worth trying again. Any other means the request was refused.
+var slackTransientErrors = []string{"internal_error", "fatal_error", "service_unavailable", "request_timeout", "ratelimited"}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	TS    string `json:"ts"`
 }
 
-func NewSlack(config *types.Slack, db *db.DB) *Slack {
-	formattedUrl := fmt.Sprintf("https://slack.com/api/chat.postMessage?token=%s&channel=%s", config.Token, config.ChannelId)
+type slackText struct {
+	Type  string `json:"type"`
+	Text  string `json:"text"`
+	Emoji bool   `json:"emoji,omitempty"`
+}
 
+type slackElement struct {
+	Type     string    `json:"type"`
+	Text     slackText `json:"text"`
+	ActionID string    `json:"action_id"`
+	Value    string    `json:"value"`
+}
+
+type slackBlock struct {
+	Type     string         `json:"type"`
+	Text     *slackText     `json:"text,omitempty"`
+	Fields   []slackText    `json:"fields,omitempty"`
+	Elements []slackElement `json:"elements,omitempty"`
+}
+
+var slackFormat = messageFormat{
+	escape: slackEscape,
+	bold:   func(s string) string { return "*" + s + "*" },
+	link:   func(s string) string { return "<" + s + ">" },
+}
+
+// slackEscape escapes the characters Slack treats as markup, see https://api.slack.com/reference/surfaces/formatting#escaping
+func slackEscape(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+func NewSlack(config *types.Slack, db *db.DB, classifier *bayes.Classifier) *Slack {
 	slack := &Slack{
-		url:      formattedUrl,
-		db:       db,
-		duration: config.Duration,
+		channelID: config.ChannelId,
+		headers: map[string]string{
+			"Content-Type":  "application/x-www-form-urlencoded",
+			"Authorization": "Bearer " + config.Token,
+		},
+		signingSecret: config.SigningSecret,
+		listenAddress: config.ListenAddress,
+		db:            db,
+		bayes:         classifier,
+		limiter:       newRateLimiter(slackMessagesPerSecond, slackMessageBurst),
 	}
 
-	go slack.processor()
+	slack.queue = &queueProcessor{
+		channel:      slack.Name(),
+		db:           db,
+		duration:     config.Duration,
+		sendBatch:    slack.notifyBlocks,
+		batch:        slackBlocksPerMessage,
+		sendFeedback: slack.sendFeedback,
+	}
 
 	return slack
 }
 
-func (s *Slack) processor() {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+func (s *Slack) Name() string {
+	return "slack"
+}
+
+func (s *Slack) Capabilities() Capabilities {
+	return Capabilities{Buttons: s.interactive(), Markdown: true, Push: true}
+}
+
+func (s *Slack) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Go(func() { s.queue.run(ctx) })
 
-	for {
-		select {
-		case <-ticker.C:
-			if s.duration != nil && !utils.IsWithinDuration(time.Now(), *s.duration) {
-				continue
-			}
+	if s.interactive() {
+		wg.Go(func() { s.listen(ctx) })
+	}
+
+	wg.Wait()
+	s.actionsRunning.Wait()
+}
 
-			messages := s.db.ConsumeSlackNotificationQueue()
+func (s *Slack) Flush() {
+	s.queue.flushWithinWindow()
+}
+
+func (s *Slack) Send(message types.Message) {
+	queueMessage(s.db, s.Name(), message)
+}
 
-			if len(messages) > 0 {
-				message := strings.Join(messages, "\n")
-				s.notify(message)
-			}
+// interactive is true when Slack can send us button presses
+func (s *Slack) interactive() bool {
+	return len(s.signingSecret) > 0
+}
+
+// notifyBlocks posts queued messages as Block Kit sections, with the text as the fallback for notifications
+func (s *Slack) notifyBlocks(payloads []string) error {
+	var blocks []slackBlock
+	var text []string
+
+	for _, payload := range payloads {
+		message, ok := queuedMessage(payload)
+
+		if !ok {
+			blocks = append(blocks, slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: payload}})
+			text = append(text, payload)
+			continue
 		}
+
+		blocks = append(blocks, slackMessageBlocks(message)...)
+		text = append(text, slackFormat.render(message))
+	}
+
+	content, err := json.Marshal(blocks)
+
+	if err != nil {
+		return err
 	}
+
+	form := url.Values{}
+	form.Add("channel", s.channelID)
+	form.Add("text", strings.Join(text, "\n"))
+	form.Add("blocks", string(content))
+
+	_, err = s.api("chat.postMessage", form)
+
+	return err
 }
 
-// TODO: Rich text messages - https://api.slack.com/reference/block-kit/blocks#rich_text
+// SendWithFeedback queues an RSS item to be sent with 👍/👎 buttons
+func (s *Slack) SendWithFeedback(message types.Message, articleHash string) {
+	queueFeedback(s.db, s.Name(), message, articleHash)
+}
+
+func (s *Slack) sendFeedback(message types.Message, articleHash string) error {
+	blocks, err := json.Marshal(append(slackMessageBlocks(message), slackFeedbackActions(articleHash, "")))
+
+	if err != nil {
+		return err
+	}
 
-func (s *Slack) notify(message string) {
 	form := url.Values{}
-	form.Add("text", message)
+	form.Add("channel", s.channelID)
+	form.Add("text", slackFormat.render(message))
+	form.Add("blocks", string(blocks))
 
-	response := utils.HttpRequest("POST", s.url, slackHeaders, strings.NewReader(form.Encode()))
+	result, err := s.api("chat.postMessage", form)
 
-	if response == nil {
-		log.Print("Could not connect to Slack API")
-		return
+	if err != nil {
+		return err
 	}
 
-	if err := response.Body.Close(); err != nil {
+	s.db.BayesSaveArticleMessage(articleHash, s.Name(), result.TS)
+
+	return nil
+}
+
+// slackMessageBlocks renders a message as Block Kit, with any fields shown side by side under the text
+func slackMessageBlocks(message types.Message) []slackBlock {
+	fields := message.Fields
+	message.Fields = nil
+
+	section := slackBlock{Type: "section", Text: &slackText{Type: "mrkdwn", Text: slackFormat.render(message)}}
+
+	for _, field := range fields {
+		section.Fields = append(section.Fields, slackText{Type: "mrkdwn", Text: "*" + slackEscape(field.Name) + "*\n" + slackEscape(field.Value)})
+	}
+
+	return []slackBlock{section}
+}
+
+// slackFeedbackActions renders 👍/👎 buttons, or once labelled the chosen label and an undo button
+func slackFeedbackActions(articleHash, label string) slackBlock {
+	buttons := []slackElement{
+		{Type: "button", Text: slackText{Type: "plain_text", Text: "👍", Emoji: true}, ActionID: "relevant", Value: "r:" + articleHash},
+		{Type: "button", Text: slackText{Type: "plain_text", Text: "👎", Emoji: true}, ActionID: "irrelevant", Value: "i:" + articleHash},
+	}
+
+	switch label {
+	case labelRelevant:
+		buttons = []slackElement{
+			{Type: "button", Text: slackText{Type: "plain_text", Text: "✅ relevant", Emoji: true}, ActionID: "relevant", Value: "r:" + articleHash},
+			{Type: "button", Text: slackText{Type: "plain_text", Text: "↩️ undo", Emoji: true}, ActionID: "undo", Value: "u:" + articleHash},
+		}
+	case labelIrrelevant:
+		buttons = []slackElement{
+			{Type: "button", Text: slackText{Type: "plain_text", Text: "🚫 irrelevant", Emoji: true}, ActionID: "irrelevant", Value: "i:" + articleHash},
+			{Type: "button", Text: slackText{Type: "plain_text", Text: "↩️ undo", Emoji: true}, ActionID: "undo", Value: "u:" + articleHash},
+		}
+	}
+
+	return slackBlock{Type: "actions", Elements: buttons}
+}
+
+// updateFeedbackMessage swaps the buttons on a sent RSS item after feedback, keeping the rest of its blocks
+func (s *Slack) updateFeedbackMessage(channelID, ts, text string, blocks []json.RawMessage, articleHash, label string) {
+	var updated []any
+
+	for _, block := range blocks {
+		var header struct {
+			Type string `json:"type"`
+		}
+
+		if json.Unmarshal(block, &header) == nil && header.Type != "actions" {
+			updated = append(updated, block)
+		}
+	}
+
+	encoded, err := json.Marshal(append(updated, slackFeedbackActions(articleHash, label)))
+
+	if err != nil {
 		log.Print(err)
+		return
+	}
+
+	form := url.Values{}
+	form.Add("channel", channelID)
+	form.Add("ts", ts)
+	form.Add("text", text)
+	form.Add("blocks", string(encoded))
+
+	if _, err = s.api("chat.update", form); err != nil {
+		log.Printf("Could not update Slack feedback buttons: %v", err)
+	}
+}
+
+func (s *Slack) api(method string, form url.Values) (slackResponse, error) {
+	var result slackResponse
+
+	err := s.limiter.do(func() error {
+		var err error
+		result, err = s.post(method, form)
+		return err
+	})
+
+	return result, err
+}
+
+func (s *Slack) post(method string, form url.Values) (slackResponse, error) {
+	var result slackResponse
+
+	response := utils.HttpRequest("POST", slackAPIBase+method, s.headers, strings.NewReader(form.Encode()))
+
+	if response == nil {
+		return result, errors.New("could not connect to Slack API")
+	}
+
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		return result, &rateLimitedError{platform: "Slack", retryAfter: retryAfterHeader(response)}
+	}
+
+	body, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		return result, err
+	}
+
+	if err = json.Unmarshal(body, &result); err != nil {
+		return result, fmt.Errorf("could not parse Slack response (status %s): %v", response.Status, err)
 	}
+
+	if !result.OK {
+		err = fmt.Errorf("slack returned error: %s", result.Error)
+
+		if slices.Contains(slackTransientErrors, result.Error) {
+			return result, err
+		}
+
+		return result, &rejectedError{err: err}
+	}
+
+	return result, nil
 }
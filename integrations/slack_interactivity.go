@@ -0,0 +1,164 @@
+package integrations
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	slackActionsPath = "/slack/actions"
+	// Requests older than this are rejected to stop replayed button presses
+	slackMaxRequestAge = 5 * time.Minute
+	slackMaxBodySize   = 1 << 20
+	// How long to let requests being handled finish when stopping
+	slackShutdownTimeout = 5 * time.Second
+)
+
+type slackActionPayload struct {
+	Type    string `json:"type"`
+	Actions []struct {
+		ActionID string `json:"action_id"`
+		Value    string `json:"value"`
+	} `json:"actions"`
+	Channel struct {
+		ID string `json:"id"`
+	} `json:"channel"`
+	Message struct {
+		TS     string            `json:"ts"`
+		Text   string            `json:"text"`
+		Blocks []json.RawMessage `json:"blocks"`
+	} `json:"message"`
+}
+
+// listen serves the Slack app's interactivity request URL, which receives block_actions when a button is pressed.
+// It stops when the context is cancelled.
+func (s *Slack) listen(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(slackActionsPath, s.handleActions)
+
+	server := &http.Server{
+		Addr:              s.listenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	stopped := make(chan struct{})
+
+	stop := context.AfterFunc(ctx, func() {
+		defer close(stopped)
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), slackShutdownTimeout)
+		defer cancel()
+
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Could not stop the Slack interactivity endpoint: %v", err)
+		}
+	})
+
+	log.Printf("Listening for Slack button presses on %s%s", s.listenAddress, slackActionsPath)
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Printf("Slack interactivity endpoint stopped: %v", err)
+	}
+
+	// Let requests still being handled finish, so none start more work once stopped
+	if !stop() {
+		<-stopped
+	}
+}
+
+func (s *Slack) handleActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, slackMaxBodySize))
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	err = verifySlackSignature(s.signingSecret, r.Header, body, time.Now())
+
+	if err != nil {
+		log.Printf("Rejected Slack request: %v", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	form, err := url.ParseQuery(string(body))
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var payload slackActionPayload
+
+	if err = json.Unmarshal([]byte(form.Get("payload")), &payload); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	// Slack expects a response within 3 seconds, so train and update the message afterwards
+	w.WriteHeader(http.StatusOK)
+
+	if payload.Type != "block_actions" {
+		return
+	}
+
+	s.actionsRunning.Go(func() { s.processActions(payload) })
+}
+
+func (s *Slack) processActions(payload slackActionPayload) {
+	for _, action := range payload.Actions {
+		hash, label, ok := parseFeedback(action.Value)
+
+		if !ok || !applyFeedback(s.db, s.bayes, hash, label) {
+			continue
+		}
+
+		s.updateFeedbackMessage(payload.Channel.ID, payload.Message.TS, payload.Message.Text, payload.Message.Blocks, hash, label)
+	}
+}
+
+// verifySlackSignature checks the request came from Slack, see https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(signingSecret string, header http.Header, body []byte, now time.Time) error {
+	timestamp := header.Get("X-Slack-Request-Timestamp")
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %q", timestamp)
+	}
+
+	age := now.Sub(time.Unix(seconds, 0))
+
+	if age > slackMaxRequestAge || age < -slackMaxRequestAge {
+		return fmt.Errorf("request timestamp is %s old", age.Round(time.Second))
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(header.Get("X-Slack-Signature"))) {
+		return fmt.Errorf("signature mismatch")
+	}
+
+	return nil
+}
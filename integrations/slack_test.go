@@ -0,0 +1,63 @@
+package integrations
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func signSlackRequest(secret string, timestamp time.Time, body []byte) http.Header {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("v0:" + ts + ":"))
+	mac.Write(body)
+
+	header := http.Header{}
+	header.Set("X-Slack-Request-Timestamp", ts)
+	header.Set("X-Slack-Signature", "v0="+hex.EncodeToString(mac.Sum(nil)))
+
+	return header
+}
+
+func TestVerifySlackSignature(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("payload=%7B%22type%22%3A%22block_actions%22%7D")
+	header := signSlackRequest("secret", now, body)
+
+	assert.NoError(t, verifySlackSignature("secret", header, body, now))
+	assert.NoError(t, verifySlackSignature("secret", header, body, now.Add(time.Minute)))
+
+	assert.Error(t, verifySlackSignature("wrong", header, body, now), "wrong secret")
+	assert.Error(t, verifySlackSignature("secret", header, []byte("payload=tampered"), now), "tampered body")
+	assert.Error(t, verifySlackSignature("secret", header, body, now.Add(6*time.Minute)), "replayed request")
+	assert.Error(t, verifySlackSignature("secret", http.Header{}, body, now), "missing headers")
+}
+
+func TestSlackFeedbackActions(t *testing.T) {
+	actions := slackFeedbackActions("abc", "")
+	assert.Equal(t, "actions", actions.Type)
+	assert.Equal(t, "r:abc", actions.Elements[0].Value)
+	assert.Equal(t, "i:abc", actions.Elements[1].Value)
+
+	actions = slackFeedbackActions("abc", labelIrrelevant)
+	assert.Equal(t, "🚫 irrelevant", actions.Elements[0].Text.Text)
+	assert.Equal(t, "u:abc", actions.Elements[1].Value)
+}
+
+func TestSlackMessageBlocks(t *testing.T) {
+	blocks := slackMessageBlocks(types.Message{
+		Title:  "Q&A <live>",
+		Fields: []types.MessageField{{Name: "Score", Value: "0.9"}},
+	})
+
+	assert.Len(t, blocks, 1)
+	assert.Equal(t, "Q&amp;A &lt;live&gt;", blocks[0].Text.Text)
+	assert.Equal(t, "*Score*\n0.9", blocks[0].Fields[0].Text)
+}
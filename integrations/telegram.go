@@ -1,13 +1,19 @@
 package integrations
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
 	"io"
 	"log"
+	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/antfie/FoxBot/bayes"
@@ -20,120 +26,263 @@ type Telegram struct {
 	apiBase  string
 	chatID   string
 	db       *db.DB
-	duration *types.TimeDuration
 	bayes    *bayes.Classifier
+	limiter  *rateLimiter
+	commands atomic.Pointer[Commands]
+	// Commands run alongside the poll, so they are waited for when stopping
+	commandsRunning sync.WaitGroup
+	queue           *queueProcessor
 }
 
+const (
+	telegramLongPollTimeout = 50 * time.Second
+	telegramPollMinBackoff  = time.Second
+	telegramPollMaxBackoff  = 5 * time.Minute
+	telegramCommandTimeout  = time.Minute
+)
+
+// Telegram allows about one message per second to the same chat, with short bursts
+const (
+	telegramMessagesPerSecond = 1
+	telegramMessageBurst      = 3
+)
+
 var telegramHeaders = map[string]string{
 	"Content-Type": "application/x-www-form-urlencoded",
 }
 
 type telegramResponse struct {
+	OK          bool            `json:"ok"`
+	ErrorCode   int             `json:"error_code"`
+	Description string          `json:"description"`
+	Result      json.RawMessage `json:"result"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+type telegramUpdatesResponse struct {
 	OK     bool             `json:"ok"`
 	Result []telegramUpdate `json:"result"`
 }
 
 type telegramUpdate struct {
 	UpdateID      int                    `json:"update_id"`
+	Message       *telegramMessage       `json:"message"`
 	CallbackQuery *telegramCallbackQuery `json:"callback_query"`
 }
 
+type telegramMessage struct {
+	MessageID int    `json:"message_id"`
+	Text      string `json:"text"`
+	Chat      struct {
+		ID int64 `json:"id"`
+	} `json:"chat"`
+}
+
 type telegramCallbackQuery struct {
-	ID   string `json:"id"`
-	Data string `json:"data"`
+	ID      string           `json:"id"`
+	Data    string           `json:"data"`
+	Message *telegramMessage `json:"message"`
 }
 
 func NewTelegram(config *types.Telegram, db *db.DB, classifier *bayes.Classifier) *Telegram {
 	t := &Telegram{
-		apiBase:  fmt.Sprintf("https://api.telegram.org/bot%s", config.Token),
-		chatID:   config.ChatID,
-		db:       db,
-		duration: config.Duration,
-		bayes:    classifier,
+		apiBase: fmt.Sprintf("https://api.telegram.org/bot%s", config.Token),
+		chatID:  config.ChatID,
+		db:      db,
+		bayes:   classifier,
+		limiter: newRateLimiter(telegramMessagesPerSecond, telegramMessageBurst),
 	}
 
-	go t.processor()
-	go t.feedbackProcessor()
+	t.queue = &queueProcessor{
+		channel:      t.Name(),
+		db:           db,
+		duration:     config.Duration,
+		limit:        telegramMessageLimit,
+		html:         true,
+		render:       htmlRenderer(telegramFormat),
+		send:         t.notify,
+		sendFeedback: t.sendFeedback,
+	}
 
 	return t
 }
 
-func (t *Telegram) processor() {
-	ticker := time.NewTicker(5 * time.Second)
-	defer ticker.Stop()
+func (t *Telegram) Name() string {
+	return "telegram"
+}
 
-	for {
-		select {
-		case <-ticker.C:
-			if t.duration != nil && !utils.IsWithinDuration(time.Now(), *t.duration) {
-				continue
-			}
+func (t *Telegram) Capabilities() Capabilities {
+	return Capabilities{Buttons: true, Push: true}
+}
 
-			messages := t.db.ConsumeTelegramNotificationQueue()
+func (t *Telegram) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	wg.Go(func() { t.queue.run(ctx) })
+	wg.Go(func() { t.feedbackProcessor(ctx) })
+	wg.Wait()
 
-			if len(messages) > 0 {
-				message := strings.Join(messages, "\n")
-				t.notify(message)
-			}
-		}
-	}
+	// Commands from the last poll may still be replying
+	t.commandsRunning.Wait()
+}
+
+func (t *Telegram) Flush() {
+	t.queue.flushWithinWindow()
+}
+
+var telegramFormat = messageFormat{
+	escape: html.EscapeString,
+	bold:   func(s string) string { return "<b>" + s + "</b>" },
+	link:   html.EscapeString,
 }
 
-func (t *Telegram) notify(message string) {
+func (t *Telegram) Send(message types.Message) {
+	queueMessage(t.db, t.Name(), message)
+}
+
+func (t *Telegram) notify(message string) error {
 	form := url.Values{}
 	form.Add("chat_id", t.chatID)
 	form.Add("text", message)
+	form.Add("parse_mode", "HTML")
 
-	response := utils.HttpRequest("POST", t.apiBase+"/sendMessage", telegramHeaders, strings.NewReader(form.Encode()))
+	_, err := t.sendMessage(form)
 
-	if response == nil {
-		log.Print("Could not connect to Telegram API")
-		return
-	}
+	return err
+}
 
-	if err := response.Body.Close(); err != nil {
-		log.Print(err)
+// SendWithFeedback queues an RSS item to be sent with 👍/👎 buttons. Sending is left to the outbox, so a burst of
+// items waiting on the rate limit does not hold up the RSS task.
+func (t *Telegram) SendWithFeedback(message types.Message, articleHash string) {
+	queueFeedback(t.db, t.Name(), message, articleHash)
+}
+
+func (t *Telegram) sendFeedback(message types.Message, articleHash string) error {
+	form := url.Values{}
+	form.Add("chat_id", t.chatID)
+	form.Add("text", telegramFormat.render(message))
+	form.Add("parse_mode", "HTML")
+	form.Add("reply_markup", feedbackKeyboard(articleHash))
+
+	messageID, err := t.sendMessage(form)
+
+	if err != nil {
+		return err
 	}
+
+	t.db.BayesSaveArticleMessage(articleHash, t.Name(), strconv.Itoa(messageID))
+
+	return nil
 }
 
-func (t *Telegram) SendWithFeedback(message, articleHash string) {
-	if t.duration != nil && !utils.IsWithinDuration(time.Now(), *t.duration) {
-		return
+func feedbackKeyboard(articleHash string) string {
+	return fmt.Sprintf(`{"inline_keyboard":[[{"text":"👍","callback_data":"r:%s"},{"text":"👎","callback_data":"i:%s"}]]}`, articleHash, articleHash)
+}
+
+// labelledKeyboard replaces the feedback buttons once an article has been labelled
+func labelledKeyboard(articleHash, label string) string {
+	text := "🚫 irrelevant"
+	prefix := "i"
+
+	if label == labelRelevant {
+		text = "✅ relevant"
+		prefix = "r"
 	}
 
-	replyMarkup := fmt.Sprintf(`{"inline_keyboard":[[{"text":"👍","callback_data":"r:%s"},{"text":"👎","callback_data":"i:%s"}]]}`, articleHash, articleHash)
+	return fmt.Sprintf(`{"inline_keyboard":[[{"text":"%s","callback_data":"%s:%s"},{"text":"↩️ undo","callback_data":"u:%s"}]]}`, text, prefix, articleHash, articleHash)
+}
 
-	form := url.Values{}
-	form.Add("chat_id", t.chatID)
-	form.Add("text", message)
-	form.Add("reply_markup", replyMarkup)
+// sendMessage returns the ID of the sent message
+func (t *Telegram) sendMessage(form url.Values) (int, error) {
+	var message telegramMessage
+
+	err := t.limiter.do(func() error {
+		result, err := t.post("sendMessage", form)
+
+		if err != nil {
+			return err
+		}
+
+		return json.Unmarshal(result, &message)
+	})
+
+	return message.MessageID, err
+}
 
-	response := utils.HttpRequest("POST", t.apiBase+"/sendMessage", telegramHeaders, strings.NewReader(form.Encode()))
+// post calls a Bot API method and returns its result
+func (t *Telegram) post(method string, form url.Values) (json.RawMessage, error) {
+	response := utils.HttpRequest("POST", t.apiBase+"/"+method, telegramHeaders, strings.NewReader(form.Encode()))
 
 	if response == nil {
-		log.Print("Could not connect to Telegram API for feedback message")
-		return
+		return nil, errors.New("could not connect to Telegram API")
 	}
 
-	if err := response.Body.Close(); err != nil {
-		log.Print(err)
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	body, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var result telegramResponse
+
+	if err = json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("could not parse Telegram response (status %s): %v", response.Status, err)
 	}
+
+	if result.ErrorCode == http.StatusTooManyRequests {
+		retryAfter := defaultRetryAfter
+
+		if result.Parameters.RetryAfter > 0 {
+			retryAfter = time.Duration(result.Parameters.RetryAfter) * time.Second
+		}
+
+		return nil, &rateLimitedError{platform: "Telegram", retryAfter: retryAfter}
+	}
+
+	if !result.OK {
+		return nil, rejectedByStatus(result.ErrorCode, fmt.Errorf("telegram returned error: %s", result.Description))
+	}
+
+	return result.Result, nil
 }
 
-func (t *Telegram) feedbackProcessor() {
-	ticker := time.NewTicker(30 * time.Minute)
-	defer ticker.Stop()
+func (t *Telegram) feedbackProcessor(ctx context.Context) {
+	backoff := telegramPollMinBackoff
+
+	for ctx.Err() == nil {
+		err := t.pollFeedback(ctx)
+
+		if err == nil {
+			backoff = telegramPollMinBackoff
+			continue
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Telegram getUpdates failed, retrying in %s: %v", backoff, err)
 
-	for {
 		select {
-		case <-ticker.C:
-			t.pollFeedback()
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
 		}
+
+		backoff = min(backoff*2, telegramPollMaxBackoff)
 	}
 }
 
-func (t *Telegram) pollFeedback() {
-	offsetStr := t.db.GetTelegramState("update_offset")
+// pollFeedback long polls getUpdates, so it returns as soon as there is an update or after telegramLongPollTimeout
+func (t *Telegram) pollFeedback(ctx context.Context) error {
+	offsetStr := t.db.GetIntegrationState(t.Name(), "update_offset")
 
 	offset := 0
 	if len(offsetStr) > 0 {
@@ -146,15 +295,16 @@ func (t *Telegram) pollFeedback() {
 		}
 	}
 
-	requestURL := fmt.Sprintf("%s/getUpdates?timeout=0", t.apiBase)
+	requestURL := fmt.Sprintf("%s/getUpdates?timeout=%d", t.apiBase, int(telegramLongPollTimeout.Seconds()))
 	if offset > 0 {
 		requestURL = fmt.Sprintf("%s&offset=%d", requestURL, offset)
 	}
 
-	response := utils.HttpRequest("GET", requestURL, nil, nil)
+	// Allow the server to hold the request for the full long poll timeout
+	response, err := utils.HttpRequestOnce(ctx, "GET", requestURL, nil, nil, telegramLongPollTimeout+10*time.Second)
 
-	if response == nil {
-		return
+	if err != nil {
+		return err
 	}
 
 	defer func() {
@@ -166,18 +316,16 @@ func (t *Telegram) pollFeedback() {
 	body, err := io.ReadAll(response.Body)
 
 	if err != nil {
-		log.Printf("Could not read Telegram getUpdates response: %v", err)
-		return
+		return fmt.Errorf("could not read response: %v", err)
 	}
 
-	var result telegramResponse
+	var result telegramUpdatesResponse
 	if err = json.Unmarshal(body, &result); err != nil {
-		log.Printf("Could not parse Telegram getUpdates response: %v", err)
-		return
+		return fmt.Errorf("could not parse response (status %s): %v", response.Status, err)
 	}
 
 	if !result.OK {
-		return
+		return fmt.Errorf("telegram returned status %s", response.Status)
 	}
 
 	maxUpdateID := offset - 1
@@ -187,74 +335,139 @@ func (t *Telegram) pollFeedback() {
 			maxUpdateID = update.UpdateID
 		}
 
-		if update.CallbackQuery == nil {
-			continue
+		if update.Message != nil {
+			t.processMessage(ctx, update.Message)
 		}
 
-		t.processCallback(update.CallbackQuery)
+		if update.CallbackQuery != nil {
+			t.processCallback(update.CallbackQuery)
+		}
 	}
 
 	if maxUpdateID >= offset {
-		t.db.SetTelegramState("update_offset", strconv.Itoa(maxUpdateID+1))
+		t.db.SetIntegrationState(t.Name(), "update_offset", strconv.Itoa(maxUpdateID+1))
 	}
+
+	return nil
 }
 
-func (t *Telegram) processCallback(query *telegramCallbackQuery) {
-	data := query.Data
+// SetCommands enables chat commands such as /status and lists them in the Telegram command menu
+func (t *Telegram) SetCommands(commands *Commands) {
+	t.commands.Store(commands)
+
+	type botCommand struct {
+		Command     string `json:"command"`
+		Description string `json:"description"`
+	}
+
+	var menu []botCommand
+
+	for _, command := range commands.List() {
+		menu = append(menu, botCommand{Command: command.Name, Description: command.Description})
+	}
 
-	if len(data) < 3 || data[1] != ':' {
+	data, err := json.Marshal(menu)
+
+	if err != nil {
+		log.Print(err)
 		return
 	}
 
-	prefix := data[0]
-	hash := data[2:]
+	form := url.Values{}
+	form.Add("commands", string(data))
 
-	feedGroup, title, currentLabel, found := t.db.BayesGetArticle(hash)
+	if _, err = t.post("setMyCommands", form); err != nil {
+		log.Printf("Could not set Telegram bot commands: %v", err)
+	}
+}
 
-	if !found {
-		log.Printf("Bayes article not found for hash: %s", hash)
-		t.answerCallback(query.ID)
+func (t *Telegram) processMessage(ctx context.Context, message *telegramMessage) {
+	// Only the configured chat may control the bot
+	if strconv.FormatInt(message.Chat.ID, 10) != t.chatID {
+		log.Printf("Ignoring Telegram message from unknown chat %d", message.Chat.ID)
 		return
 	}
 
-	newLabel := "irrelevant"
-	if prefix == 'r' {
-		newLabel = "relevant"
+	commands := t.commands.Load()
+
+	if commands == nil {
+		return
 	}
 
-	// Same button pressed again — ignore duplicate
-	if currentLabel == newLabel {
-		log.Printf("Bayes [%s] duplicate %s ignored: %s", feedGroup, newLabel, title)
-		t.answerCallback(query.ID)
+	if !strings.HasPrefix(strings.TrimSpace(message.Text), "/") {
 		return
 	}
 
-	// Changed mind — untrain old label first
-	if len(currentLabel) > 0 {
-		t.bayes.Untrain(feedGroup, title, currentLabel == "relevant")
-		log.Printf("Bayes [%s] changed %s -> %s: %s", feedGroup, currentLabel, newLabel, title)
-	} else {
-		log.Printf("Bayes [%s] trained as %s: %s", feedGroup, newLabel, title)
+	// Commands such as /weather make requests of their own, so they run alongside the poll rather than holding it up
+	t.commandsRunning.Go(func() { t.runCommand(ctx, commands, message) })
+}
+
+func (t *Telegram) runCommand(ctx context.Context, commands *Commands, message *telegramMessage) {
+	ctx, cancel := context.WithTimeout(ctx, telegramCommandTimeout)
+	defer cancel()
+
+	reply, isCommand := commands.Execute(ctx, message.Text)
+
+	if !isCommand {
+		return
 	}
 
-	// Train with new label
-	t.bayes.Train(feedGroup, title, prefix == 'r')
-	t.db.BayesSetArticleLabel(hash, newLabel)
+	// Replies are sent straight away, ignoring the from/to window, as someone is waiting for them
+	form := url.Values{}
+	form.Add("chat_id", t.chatID)
+	form.Add("text", reply)
+	form.Add("reply_to_message_id", strconv.Itoa(message.MessageID))
+
+	if _, err := t.sendMessage(form); err != nil {
+		log.Printf("Could not reply to Telegram command: %v", err)
+	}
+}
 
+func (t *Telegram) processCallback(query *telegramCallbackQuery) {
+	// Answer straight away so the button stops spinning in the client
 	t.answerCallback(query.ID)
+
+	hash, label, ok := parseFeedback(query.Data)
+
+	if !ok || !applyFeedback(t.db, t.bayes, hash, label) {
+		return
+	}
+
+	if len(label) == 0 {
+		t.editReplyMarkup(query, hash, feedbackKeyboard(hash))
+		return
+	}
+
+	t.editReplyMarkup(query, hash, labelledKeyboard(hash, label))
 }
 
-func (t *Telegram) answerCallback(callbackQueryID string) {
-	form := url.Values{}
-	form.Add("callback_query_id", callbackQueryID)
+// editReplyMarkup swaps the buttons on the message the feedback came from
+func (t *Telegram) editReplyMarkup(query *telegramCallbackQuery, hash, replyMarkup string) {
+	messageID := t.db.BayesGetArticleMessage(hash, t.Name())
 
-	response := utils.HttpRequest("POST", t.apiBase+"/answerCallbackQuery", telegramHeaders, strings.NewReader(form.Encode()))
+	if query.Message != nil {
+		messageID = strconv.Itoa(query.Message.MessageID)
+	}
 
-	if response == nil {
+	if len(messageID) == 0 {
 		return
 	}
 
-	if err := response.Body.Close(); err != nil {
-		log.Print(err)
+	form := url.Values{}
+	form.Add("chat_id", t.chatID)
+	form.Add("message_id", messageID)
+	form.Add("reply_markup", replyMarkup)
+
+	if _, err := t.post("editMessageReplyMarkup", form); err != nil {
+		log.Printf("Could not update Telegram feedback buttons: %v", err)
+	}
+}
+
+func (t *Telegram) answerCallback(callbackQueryID string) {
+	form := url.Values{}
+	form.Add("callback_query_id", callbackQueryID)
+
+	if _, err := t.post("answerCallbackQuery", form); err != nil {
+		log.Printf("Could not answer Telegram callback: %v", err)
 	}
 }
@@ -0,0 +1,46 @@
+package integrations
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testKeyboard struct {
+	InlineKeyboard [][]struct {
+		Text         string `json:"text"`
+		CallbackData string `json:"callback_data"`
+	} `json:"inline_keyboard"`
+}
+
+func parseKeyboard(t *testing.T, replyMarkup string) testKeyboard {
+	t.Helper()
+
+	var keyboard testKeyboard
+	assert.NoError(t, json.Unmarshal([]byte(replyMarkup), &keyboard))
+	assert.Len(t, keyboard.InlineKeyboard, 1)
+
+	return keyboard
+}
+
+func TestFeedbackKeyboard(t *testing.T) {
+	keyboard := parseKeyboard(t, feedbackKeyboard("abc123"))
+
+	assert.Equal(t, "👍", keyboard.InlineKeyboard[0][0].Text)
+	assert.Equal(t, "r:abc123", keyboard.InlineKeyboard[0][0].CallbackData)
+	assert.Equal(t, "👎", keyboard.InlineKeyboard[0][1].Text)
+	assert.Equal(t, "i:abc123", keyboard.InlineKeyboard[0][1].CallbackData)
+}
+
+func TestLabelledKeyboard(t *testing.T) {
+	keyboard := parseKeyboard(t, labelledKeyboard("abc123", "relevant"))
+
+	assert.Equal(t, "✅ relevant", keyboard.InlineKeyboard[0][0].Text)
+	assert.Equal(t, "u:abc123", keyboard.InlineKeyboard[0][1].CallbackData)
+
+	keyboard = parseKeyboard(t, labelledKeyboard("abc123", "irrelevant"))
+
+	assert.Equal(t, "🚫 irrelevant", keyboard.InlineKeyboard[0][0].Text)
+	assert.Equal(t, "i:abc123", keyboard.InlineKeyboard[0][0].CallbackData)
+}
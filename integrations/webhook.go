@@ -0,0 +1,220 @@
+package integrations
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
+)
+
+// Webhook posts each notification to an arbitrary URL, with the body rendered from a user supplied template
+type Webhook struct {
+	name            string
+	url             string
+	method          string
+	headers         map[string]string
+	template        *template.Template
+	secret          string
+	signatureHeader string
+	db              *db.DB
+	limiter         *rateLimiter
+	queue           *queueProcessor
+}
+
+const (
+	webhookRequestsPerSecond = 5
+	webhookRequestBurst      = 10
+)
+
+const defaultWebhookTemplate = `{"text":{{json .Text}},"icon":{{json .Icon}},"title":{{json .Title}},"link":{{json .Link}},"source":{{json .Source}},"severity":{{json .Severity}},"highlights":{{json .Highlights}},"fields":{{json .Fields}},"time":{{json .Time}}}`
+
+// webhookData is what a webhook template is rendered with
+type webhookData struct {
+	// The message as plain text
+	Text       string
+	Icon       string
+	Title      string
+	Link       string
+	Source     string
+	Highlights []string
+	// info, good or bad
+	Severity string
+	Fields   []types.MessageField
+	Time     time.Time
+}
+
+var webhookTemplateFuncs = template.FuncMap{
+	// json encodes a value, so strings are quoted and escaped for use in a JSON body
+	"json": func(v any) (string, error) {
+		encoded, err := json.Marshal(v)
+		return string(encoded), err
+	},
+}
+
+func NewWebhook(config types.Webhook, db *db.DB) *Webhook {
+	text := config.Template
+
+	if len(strings.TrimSpace(text)) < 1 {
+		text = defaultWebhookTemplate
+	}
+
+	parsed, err := template.New(config.Name).Funcs(webhookTemplateFuncs).Parse(text)
+
+	if err != nil {
+		log.Fatalf("Invalid template for webhook %q: %v", config.Name, err)
+	}
+
+	headers := map[string]string{
+		"Content-Type": "application/json",
+	}
+
+	for k, v := range config.Headers {
+		headers[k] = v
+	}
+
+	w := &Webhook{
+		name:            config.Name,
+		url:             config.URL,
+		method:          config.Method,
+		headers:         headers,
+		template:        parsed,
+		secret:          config.Secret,
+		signatureHeader: config.SignatureHeader,
+		db:              db,
+		limiter:         newRateLimiter(webhookRequestsPerSecond, webhookRequestBurst),
+	}
+
+	w.queue = &queueProcessor{
+		channel:  w.Name(),
+		db:       db,
+		duration: config.Duration,
+		send:     w.notify,
+	}
+
+	return w
+}
+
+func (w *Webhook) Name() string {
+	return "webhook:" + w.name
+}
+
+func (w *Webhook) Capabilities() Capabilities {
+	return Capabilities{Push: true}
+}
+
+func (w *Webhook) Run(ctx context.Context) {
+	w.queue.run(ctx)
+}
+
+func (w *Webhook) Flush() {
+	w.queue.flushWithinWindow()
+}
+
+// Send renders the body straight away, so the queued payload is exactly what will be sent
+func (w *Webhook) Send(message types.Message) {
+	body, err := w.render(message, time.Now())
+
+	if err != nil {
+		log.Printf("Could not render %s template: %v", w.Name(), err)
+		return
+	}
+
+	w.db.QueueNotification(w.Name(), message.Severity, body)
+}
+
+func (w *Webhook) render(message types.Message, now time.Time) (string, error) {
+	var body bytes.Buffer
+
+	err := w.template.Execute(&body, webhookData{
+		Text:       FormatPlain(message),
+		Icon:       message.Icon,
+		Title:      message.Title,
+		Link:       message.Link,
+		Source:     message.Source,
+		Highlights: message.Highlights,
+		Severity:   severityName(message.Severity),
+		Fields:     message.Fields,
+		Time:       now,
+	})
+
+	return body.String(), err
+}
+
+func severityName(severity types.Severity) string {
+	switch severity {
+	case types.SeverityGood:
+		return "good"
+	case types.SeverityBad:
+		return "bad"
+	default:
+		return "info"
+	}
+}
+
+func (w *Webhook) notify(body string) error {
+	return w.limiter.do(func() error {
+		return w.post(body)
+	})
+}
+
+func (w *Webhook) post(body string) error {
+	headers := w.headers
+
+	if len(w.secret) > 0 {
+		headers = map[string]string{}
+
+		for k, v := range w.headers {
+			headers[k] = v
+		}
+
+		headers[w.signatureHeader] = signWebhookBody(w.secret, body)
+	}
+
+	return deliverHTTP(w.Name(), w.method, w.url, headers, body)
+}
+
+// deliverHTTP sends a request for outputs that only need a 2xx response, reporting 429s to the rate limiter
+func deliverHTTP(platform, method, url string, headers map[string]string, body string) error {
+	response := utils.HttpRequest(method, url, headers, strings.NewReader(body))
+
+	if response == nil {
+		return errors.New("could not connect to " + platform)
+	}
+
+	defer func() {
+		if err := response.Body.Close(); err != nil {
+			log.Print(err)
+		}
+	}()
+
+	if response.StatusCode == http.StatusTooManyRequests {
+		return &rateLimitedError{platform: platform, retryAfter: retryAfterHeader(response)}
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("%s returned status %s", platform, response.Status)
+	}
+
+	return nil
+}
+
+// signWebhookBody returns "sha256=" and the hex HMAC-SHA256 of the body, the scheme GitHub webhooks use
+func signWebhookBody(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
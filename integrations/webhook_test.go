@@ -0,0 +1,47 @@
+package integrations
+
+import (
+	"encoding/json"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testWebhook(t *testing.T, text string) *Webhook {
+	t.Helper()
+
+	parsed, err := template.New("test").Funcs(webhookTemplateFuncs).Parse(text)
+	assert.NoError(t, err)
+
+	return &Webhook{name: "test", template: parsed}
+}
+
+func TestWebhookDefaultTemplate(t *testing.T) {
+	w := testWebhook(t, defaultWebhookTemplate)
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	body, err := w.render(types.Message{Icon: "📰", Title: `Say "hi"`, Link: "https://example.com", Severity: types.SeverityBad}, now)
+	assert.NoError(t, err)
+
+	var decoded map[string]any
+	assert.NoError(t, json.Unmarshal([]byte(body), &decoded))
+	assert.Equal(t, `📰 Say "hi" - https://example.com`, decoded["text"])
+	assert.Equal(t, "bad", decoded["severity"])
+	assert.Equal(t, "2026-01-02T03:04:05Z", decoded["time"])
+}
+
+func TestWebhookCustomTemplate(t *testing.T) {
+	w := testWebhook(t, `{"message":{{json .Title}},"priority":"{{if eq .Severity "bad"}}high{{else}}normal{{end}}"}`)
+
+	body, err := w.render(types.Message{Title: "Disk full", Severity: types.SeverityBad}, time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"message":"Disk full","priority":"high"}`, body)
+}
+
+func TestSignWebhookBody(t *testing.T) {
+	// echo -n 'hello' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=88aab3ede8d3adf94d26ab90d3bafd4a2083070c3bcce9c014ee04a443847c0b", signWebhookBody("secret", "hello"))
+}
@@ -1,7 +1,9 @@
 package main
 
 import (
+	"context"
 	_ "embed"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -10,18 +12,25 @@ import (
 	"path/filepath"
 	"runtime"
 	"syscall"
+	"time"
+	// Embeds the timezone database for time windows, as small devices may not have one installed
+	_ "time/tzdata"
 
 	"github.com/antfie/FoxBot/bayes"
 	"github.com/antfie/FoxBot/config"
 	"github.com/antfie/FoxBot/db"
 	"github.com/antfie/FoxBot/integrations"
 	"github.com/antfie/FoxBot/tasks"
+	"github.com/antfie/FoxBot/types"
 	"github.com/antfie/FoxBot/utils"
 )
 
 //go:embed config.yaml
 var defaultConfigData []byte
 
+// How long to wait for running tasks to stop once asked to
+const shutdownTimeout = 10 * time.Second
+
 //goland:noinspection GoUnnecessarilyExportedIdentifiers
 var AppVersion = "0.0"
 
@@ -35,9 +44,13 @@ func main() {
 		}
 	}()
 
+	replay := flag.String("replay", "", "Answer HTTP requests from the fixtures in this directory instead of the network")
+	record := flag.String("record", "", "Save every HTTP response to this directory as a fixture for --replay")
+	flag.Parse()
+
 	print(fmt.Sprintf("FoxBot version %s\n", AppVersion))
 
-	c := config.Load(defaultConfigData)
+	c := config.Load(flag.Arg(0), defaultConfigData)
 
 	if len(c.LogPath) > 0 {
 		logFile, err := os.OpenFile(filepath.Clean(c.LogPath), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600) //#nosec G304 -- log path is from config
@@ -50,27 +63,67 @@ func main() {
 		log.SetOutput(io.MultiWriter(os.Stderr, logFile))
 	}
 
+	switch {
+	case len(*replay) > 0:
+		log.Printf("Replaying HTTP fixtures from %s", *replay)
+		utils.SetHttpClient(utils.NewReplayClient(c.Http, *replay))
+	case len(*record) > 0:
+		log.Printf("Recording HTTP fixtures to %s", *record)
+		utils.SetHttpClient(utils.NewHttpClient(c.Http, utils.NewRecordTransport(*record, utils.NewHttpTransport(c.Http))))
+	default:
+		utils.SetHttpClient(utils.NewHttpClient(c.Http, nil))
+	}
+
 	if c.CheckForNewVersions && AppVersion != "0.0" {
 		checkForUpdates()
 	}
 
 	task := &tasks.Context{
-		Config: c,
-		DB:     db.NewDB(c.DBPath),
+		Config:    c,
+		DB:        db.NewDB(c.DBPath),
+		Notifiers: integrations.NewRegistry(),
+		Fetches:   utils.NewPool(c.Concurrency.Workers, c.Concurrency.PerHost),
 	}
 
 	task.Bayes = bayes.NewClassifier(task.DB)
 
+	if c.Output.Console {
+		task.Notifiers.Register(integrations.NewConsole(), nil)
+	}
+
 	if c.Output.Slack != nil {
-		task.Slack = integrations.NewSlack(c.Output.Slack, task.DB)
+		task.Notifiers.Register(integrations.NewSlack(c.Output.Slack, task.DB, task.Bayes), c.Output.Slack.Routes)
 	}
 
+	var telegram *integrations.Telegram
+
 	if c.Output.Telegram != nil {
-		task.Telegram = integrations.NewTelegram(c.Output.Telegram, task.DB, task.Bayes)
+		telegram = integrations.NewTelegram(c.Output.Telegram, task.DB, task.Bayes)
+		task.Notifiers.Register(telegram, c.Output.Telegram.Routes)
 	}
 
 	if c.Output.Discord != nil {
-		task.Discord = integrations.NewDiscord(c.Output.Discord, task.DB)
+		task.Notifiers.Register(integrations.NewDiscord(c.Output.Discord, task.DB, task.Bayes), c.Output.Discord.Routes)
+	}
+
+	if c.Output.Matrix != nil {
+		task.Notifiers.Register(integrations.NewMatrix(c.Output.Matrix, task.DB, task.Bayes), c.Output.Matrix.Routes)
+	}
+
+	if c.Output.Ntfy != nil {
+		task.Notifiers.Register(integrations.NewNtfy(c.Output.Ntfy, task.DB), c.Output.Ntfy.Routes)
+	}
+
+	if c.Output.Gotify != nil {
+		task.Notifiers.Register(integrations.NewGotify(c.Output.Gotify, task.DB), c.Output.Gotify.Routes)
+	}
+
+	if c.Output.Email != nil {
+		task.Notifiers.Register(integrations.NewEmail(c.Output.Email, task.DB), c.Output.Email.Routes)
+	}
+
+	for _, webhook := range c.Output.Webhooks {
+		task.Notifiers.Register(integrations.NewWebhook(webhook, task.DB), webhook.Routes)
 	}
 
 	var tasksToRun []*tasks.Task
@@ -79,7 +132,7 @@ func main() {
 		if len(c.Reminders.Reminders) < 1 {
 			log.Print("No reminders configured.")
 		} else {
-			tasksToRun = append(tasksToRun, tasks.NewTask(c.Reminders.Check.Frequency, task.Reminders))
+			tasksToRun = append(tasksToRun, tasks.NewTask("reminders", c.Reminders.Check, task.Reminders))
 		}
 	}
 
@@ -87,7 +140,7 @@ func main() {
 		if len(c.Countdown.Timers) < 1 {
 			log.Print("No countdown timers configured.")
 		} else {
-			tasksToRun = append(tasksToRun, tasks.NewTask(c.Countdown.Check.Frequency, task.Countdown))
+			tasksToRun = append(tasksToRun, tasks.NewTask("countdown", c.Countdown.Check, task.Countdown))
 		}
 	}
 
@@ -95,7 +148,7 @@ func main() {
 		if len(c.RSS.Feeds) < 1 {
 			log.Print("No RSS feeds configured.")
 		} else {
-			tasksToRun = append(tasksToRun, tasks.NewTask(c.RSS.Check.Frequency, task.RSS))
+			tasksToRun = append(tasksToRun, tasks.NewTask("rss", c.RSS.Check, task.RSS))
 		}
 	}
 
@@ -103,7 +156,7 @@ func main() {
 		if len(c.SiteChanges.Sites) < 1 {
 			log.Print("No sites to monitor configured.")
 		} else {
-			tasksToRun = append(tasksToRun, tasks.NewTask(c.SiteChanges.Check.Frequency, task.SiteChanges))
+			tasksToRun = append(tasksToRun, tasks.NewTask("site_changes", c.SiteChanges.Check, task.SiteChanges))
 		}
 	}
 
@@ -111,7 +164,7 @@ func main() {
 		if len(c.Weather.Locations) < 1 {
 			log.Print("No weather locations configured.")
 		} else {
-			tasksToRun = append(tasksToRun, tasks.NewTask(c.Weather.Check.Frequency, task.Weather))
+			tasksToRun = append(tasksToRun, tasks.NewTask("weather", c.Weather.Check, task.Weather))
 		}
 	}
 
@@ -120,15 +173,49 @@ func main() {
 		os.Exit(1)
 	}
 
-	task.Notify(fmt.Sprintf("🦊🤖 Running with %s.", utils.Pluralize("task", len(tasksToRun))))
-	go tasks.Run(tasksToRun)
+	if telegram != nil {
+		telegram.SetCommands(task.Commands(tasksToRun))
+	}
+
+	task.Notify(types.CategoryFoxBot, fmt.Sprintf("🦊🤖 Running with %s.", utils.Pluralize("task", len(tasksToRun))))
 
-	shutdownSignal := make(chan os.Signal, 1)
-	signal.Notify(shutdownSignal, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
-	<-shutdownSignal
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
+	task.Notifiers.Start(ctx)
+
+	done := make(chan struct{})
+
+	go func() {
+		tasks.Run(ctx, tasksToRun, task.DB)
+		// The outputs' background work, such as polling for feedback, also stops with the context
+		task.Notifiers.Wait()
+		close(done)
+	}()
+
+	<-ctx.Done()
+
+	// A second signal stops straight away
+	stop()
 
 	// Clear out any "^C" from the console
 	print("\r")
 
-	task.Notify("🦊🤖 Stopped")
+	// In-flight fetches are cancelled, give the tasks and outputs a moment to finish up
+	stopped := true
+
+	select {
+	case <-done:
+	case <-time.After(shutdownTimeout):
+		stopped = false
+		log.Print("Tasks did not stop in time.")
+	}
+
+	task.Notify(types.CategoryFoxBot, "🦊🤖 Stopped")
+	task.Notifiers.Flush()
+
+	// Closing the database under something still writing to it could lose that write, so leave it to the OS
+	if stopped {
+		task.DB.Close()
+	}
 }
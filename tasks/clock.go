@@ -0,0 +1,22 @@
+package tasks
+
+import "time"
+
+// Clock is the scheduler's source of time, so tests can drive it with a fake one
+type Clock interface {
+	Now() time.Time
+	// NewTimer returns a channel that receives once d has passed, and a function that stops the timer
+	NewTimer(d time.Duration) (<-chan time.Time, func() bool)
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	timer := time.NewTimer(d)
+
+	return timer.C, timer.Stop
+}
@@ -0,0 +1,305 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/antfie/FoxBot/integrations"
+	"github.com/antfie/FoxBot/utils"
+)
+
+// Commands are the chat commands for controlling FoxBot, e.g. from Telegram
+func (c *Context) Commands(tasks []*Task) *integrations.Commands {
+	commands := integrations.NewCommands()
+
+	commands.Add(integrations.Command{
+		Name:        "status",
+		Description: "Show tasks and queued notifications",
+		Handler: func(_ context.Context, _ []string) string {
+			return c.statusCommand(tasks)
+		},
+	})
+
+	commands.Add(integrations.Command{
+		Name:        "pause",
+		Usage:       "<task> <duration>",
+		Description: "Pause a task, e.g. /pause rss 2h",
+		Handler: func(_ context.Context, args []string) string {
+			return pauseCommand(tasks, args)
+		},
+	})
+
+	commands.Add(integrations.Command{
+		Name:        "resume",
+		Usage:       "[task]",
+		Description: "Resume a paused task, or all tasks",
+		Handler: func(_ context.Context, args []string) string {
+			return resumeCommand(tasks, args)
+		},
+	})
+
+	commands.Add(integrations.Command{
+		Name:        "feeds",
+		Description: "List RSS feeds",
+		Handler: func(_ context.Context, _ []string) string {
+			return c.feedsCommand()
+		},
+	})
+
+	commands.Add(integrations.Command{
+		Name:        "mute",
+		Usage:       "<group>",
+		Description: "Stop notifying about an RSS feed group",
+		Handler: func(_ context.Context, args []string) string {
+			return c.muteCommand(args, true)
+		},
+	})
+
+	commands.Add(integrations.Command{
+		Name:        "unmute",
+		Usage:       "<group>",
+		Description: "Notify about a muted RSS feed group again",
+		Handler: func(_ context.Context, args []string) string {
+			return c.muteCommand(args, false)
+		},
+	})
+
+	commands.Add(integrations.Command{
+		Name:        "weather",
+		Usage:       "<location>",
+		Description: "Today's forecast for a configured location",
+		Handler: func(ctx context.Context, args []string) string {
+			return c.weatherCommand(ctx, args)
+		},
+	})
+
+	commands.Add(integrations.Command{
+		Name:        "countdown",
+		Description: "Show all countdown timers",
+		Handler: func(_ context.Context, _ []string) string {
+			return c.countdownCommand(time.Now())
+		},
+	})
+
+	return commands
+}
+
+func findTask(tasks []*Task, name string) *Task {
+	for _, t := range tasks {
+		if strings.EqualFold(t.Name(), name) {
+			return t
+		}
+	}
+
+	return nil
+}
+
+func taskNames(tasks []*Task) string {
+	names := make([]string, len(tasks))
+
+	for i, t := range tasks {
+		names[i] = t.Name()
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// formatRunTime shows the time of a run today, and the date too for any other day
+func formatRunTime(now, run time.Time) string {
+	run = run.In(now.Location())
+
+	if run.Year() == now.Year() && run.YearDay() == now.YearDay() {
+		return run.Format("15:04")
+	}
+
+	return run.Format("Mon 2 Jan 15:04")
+}
+
+func (c *Context) statusCommand(tasks []*Task) string {
+	now := time.Now()
+
+	var sb strings.Builder
+
+	sb.WriteString("🦊🤖 Status")
+
+	for _, t := range tasks {
+		if pausedUntil := t.PausedUntil(); now.Before(pausedUntil) {
+			fmt.Fprintf(&sb, "\n⏸️ %s: paused for %s", t.Name(), utils.FormatHumanReadableDuration(now, pausedUntil))
+			continue
+		}
+
+		fmt.Fprintf(&sb, "\n▶️ %s: next run %s", t.Name(), formatRunTime(now, t.NextExecution()))
+
+		if lastRun, duration := t.LastRun(); !lastRun.IsZero() {
+			fmt.Fprintf(&sb, ", last run %s took %s", formatRunTime(now, lastRun), duration.Round(time.Millisecond))
+		}
+	}
+
+	pending := c.DB.CountPendingNotifications()
+
+	for _, n := range c.Notifiers.Notifiers() {
+		if count, found := pending[n.Name()]; found {
+			fmt.Fprintf(&sb, "\n📤 %s: %s queued", n.Name(), utils.Pluralize("notification", count))
+		}
+	}
+
+	return sb.String()
+}
+
+func pauseCommand(tasks []*Task, args []string) string {
+	if len(args) != 2 {
+		return "Usage: /pause <task> <duration>, e.g. /pause rss 2h"
+	}
+
+	t := findTask(tasks, args[0])
+
+	if t == nil {
+		return fmt.Sprintf("Unknown task %q. Tasks: %s", args[0], taskNames(tasks))
+	}
+
+	duration, err := time.ParseDuration(args[1])
+
+	if err != nil || duration <= 0 {
+		return fmt.Sprintf("Invalid duration %q, try something like 30m or 2h", args[1])
+	}
+
+	t.Pause(time.Now().Add(duration))
+
+	return fmt.Sprintf("⏸️ Paused %s for %s", t.Name(), duration)
+}
+
+func resumeCommand(tasks []*Task, args []string) string {
+	if len(args) == 0 {
+		for _, t := range tasks {
+			t.Resume()
+		}
+
+		return "▶️ Resumed all tasks"
+	}
+
+	t := findTask(tasks, args[0])
+
+	if t == nil {
+		return fmt.Sprintf("Unknown task %q. Tasks: %s", args[0], taskNames(tasks))
+	}
+
+	t.Resume()
+
+	return fmt.Sprintf("▶️ Resumed %s", t.Name())
+}
+
+func (c *Context) feedsCommand() string {
+	if c.Config.RSS == nil || len(c.Config.RSS.Feeds) == 0 {
+		return "No RSS feeds configured"
+	}
+
+	var groups []string
+	feeds := map[string][]string{}
+
+	for _, feed := range c.Config.RSS.Feeds {
+		if !slices.Contains(groups, feed.Group) {
+			groups = append(groups, feed.Group)
+		}
+
+		feeds[feed.Group] = append(feeds[feed.Group], feed.Name)
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("📰 Feeds")
+
+	for _, group := range groups {
+		name := group
+		if len(name) == 0 {
+			name = "(no group)"
+		} else if c.DB.IsFeedGroupMuted(group) {
+			name += " 🔇"
+		}
+
+		fmt.Fprintf(&sb, "\n%s: %s", name, strings.Join(feeds[group], ", "))
+	}
+
+	return sb.String()
+}
+
+func (c *Context) muteCommand(args []string, mute bool) string {
+	if len(args) == 0 {
+		if mute {
+			return "Usage: /mute <group>"
+		}
+
+		return "Usage: /unmute <group>"
+	}
+
+	group := strings.Join(args, " ")
+
+	if c.Config.RSS != nil {
+		for _, feed := range c.Config.RSS.Feeds {
+			if strings.EqualFold(feed.Group, group) {
+				group = feed.Group
+				break
+			}
+		}
+	}
+
+	if !mute {
+		if !c.DB.UnmuteFeedGroup(group) {
+			return fmt.Sprintf("%s was not muted", group)
+		}
+
+		return fmt.Sprintf("🔊 Unmuted %s", group)
+	}
+
+	c.DB.MuteFeedGroup(group)
+
+	return fmt.Sprintf("🔇 Muted %s", group)
+}
+
+func (c *Context) weatherCommand(ctx context.Context, args []string) string {
+	if c.Config.Weather == nil || len(c.Config.Weather.Locations) == 0 {
+		return "No weather locations configured"
+	}
+
+	name := strings.Join(args, " ")
+
+	for _, location := range c.Config.Weather.Locations {
+		if len(args) > 0 && !strings.EqualFold(location.Name, name) {
+			continue
+		}
+
+		message, err := c.forecast(ctx, location)
+
+		if err != nil {
+			return fmt.Sprintf("Weather: %v", err)
+		}
+
+		return integrations.FormatPlain(message)
+	}
+
+	var names []string
+
+	for _, location := range c.Config.Weather.Locations {
+		names = append(names, location.Name)
+	}
+
+	return fmt.Sprintf("Unknown location %q. Locations: %s", name, strings.Join(names, ", "))
+}
+
+func (c *Context) countdownCommand(now time.Time) string {
+	if c.Config.Countdown == nil || len(c.Config.Countdown.Timers) == 0 {
+		return "No countdown timers configured"
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString("⏲️ Countdown")
+
+	for _, timer := range c.Config.Countdown.Timers {
+		fmt.Fprintf(&sb, "\n%s: %s", timer.Name, utils.FormatHumanReadableDuration(now, timer.Date))
+	}
+
+	return sb.String()
+}
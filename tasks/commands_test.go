@@ -0,0 +1,45 @@
+package tasks
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPauseAndResumeCommands(t *testing.T) {
+	rss := NewTask("rss", types.TimeFrequencyAndDuration{Frequency: types.Frequency{Interval: time.Hour}}, func(context.Context) (int, error) { return 0, nil })
+	weather := NewTask("weather", types.TimeFrequencyAndDuration{Frequency: types.Frequency{Interval: time.Hour}}, func(context.Context) (int, error) { return 0, nil })
+	tasks := []*Task{rss, weather}
+
+	assert.Equal(t, "⏸️ Paused rss for 2h0m0s", pauseCommand(tasks, []string{"RSS", "2h"}))
+	assert.True(t, rss.isPaused(time.Now()))
+	assert.False(t, weather.isPaused(time.Now()))
+
+	assert.Equal(t, `Unknown task "news". Tasks: rss, weather`, pauseCommand(tasks, []string{"news", "2h"}))
+	assert.Equal(t, `Invalid duration "soon", try something like 30m or 2h`, pauseCommand(tasks, []string{"rss", "soon"}))
+
+	assert.Equal(t, "▶️ Resumed all tasks", resumeCommand(tasks, nil))
+	assert.False(t, rss.isPaused(time.Now()))
+}
+
+func TestCountdownCommand(t *testing.T) {
+	c := &Context{Config: &types.Config{Countdown: &types.Countdown{
+		Timers: []types.CountdownTimer{
+			{Name: "Holiday", Date: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		},
+	}}}
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, "⏲️ Countdown\nHoliday: 2 days", c.countdownCommand(now))
+}
+
+func TestFormatRunTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, "23:30", formatRunTime(now, time.Date(2024, 1, 1, 23, 30, 0, 0, time.UTC)))
+	assert.Equal(t, "Tue 2 Jan 06:00", formatRunTime(now, time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC)))
+	assert.Equal(t, "Sun 31 Dec 22:15", formatRunTime(now, time.Date(2023, 12, 31, 22, 15, 0, 0, time.UTC)))
+}
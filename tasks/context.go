@@ -5,13 +5,14 @@ import (
 	"github.com/antfie/FoxBot/db"
 	"github.com/antfie/FoxBot/integrations"
 	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
 )
 
 type Context struct {
-	Config   *types.Config
-	DB       *db.DB
-	Slack    *integrations.Slack
-	Telegram *integrations.Telegram
-	Discord  *integrations.Discord
-	Bayes    *bayes.Classifier
+	Config    *types.Config
+	DB        *db.DB
+	Notifiers *integrations.Registry
+	Bayes     *bayes.Classifier
+	// Shared by the RSS and site change tasks to limit how much they fetch at once
+	Fetches *utils.Pool
 }
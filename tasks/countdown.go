@@ -1,24 +1,29 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
+	"github.com/antfie/FoxBot/types"
 	"github.com/antfie/FoxBot/utils"
 	"sort"
 	"sync"
 	"time"
 )
 
-func (c *Context) Countdown() {
-	c.countdown(time.Now())
+func (c *Context) Countdown(_ context.Context) (int, error) {
+	return c.countdown(time.Now()), nil
 }
 
 var countdownOnce sync.Once
 
-func (c *Context) countdown(now time.Time) {
+// countdown returns how many timers were notified
+func (c *Context) countdown(now time.Time) int {
 	if c.Config.Countdown.Check.Duration != nil && !utils.IsWithinDuration(time.Now(), *c.Config.Countdown.Check.Duration) {
-		return
+		return 0
 	}
 
+	notified := 0
+
 	timers := c.Config.Countdown.Timers
 
 	countdownOnce.Do(func() {
@@ -33,7 +38,10 @@ func (c *Context) countdown(now time.Time) {
 
 		if x.LastFormattedValue != formattedValue {
 			timers[i].LastFormattedValue = formattedValue
-			c.Notify(fmt.Sprintf("⏲️ %s: %s", x.Name, formattedValue))
+			c.Notify(types.CategoryCountdown, fmt.Sprintf("⏲️ %s: %s", x.Name, formattedValue))
+			notified++
 		}
 	}
+
+	return notified
 }
@@ -1,57 +1,16 @@
 package tasks
 
-import "github.com/antfie/FoxBot/utils"
+import "github.com/antfie/FoxBot/types"
 
-func (c *Context) Notify(message string) {
-	if c.Config.Output.Console {
-		utils.NotifyConsole(message)
-	}
-
-	if c.Config.Output.Slack != nil {
-		c.DB.QueueSlackNotification(message)
-	}
-
-	if c.Config.Output.Telegram != nil {
-		c.DB.QueueTelegramNotification(message)
-	}
-
-	if c.Config.Output.Discord != nil {
-		c.DB.QueueDiscordNotification(message)
-	}
+// Notify sends a message to the outputs routed for its category, which is the task raising it
+func (c *Context) Notify(category, message string) {
+	c.Notifiers.Notify(types.Message{Title: message, Severity: types.SeverityInfo, Category: category})
 }
 
-func (c *Context) NotifyGood(message string) {
-	if c.Config.Output.Console {
-		utils.NotifyConsoleGood(message)
-	}
-
-	if c.Config.Output.Slack != nil {
-		c.DB.QueueSlackNotification(message)
-	}
-
-	if c.Config.Output.Telegram != nil {
-		c.DB.QueueTelegramNotification(message)
-	}
-
-	if c.Config.Output.Discord != nil {
-		c.DB.QueueDiscordNotification(message)
-	}
+func (c *Context) NotifyGood(category, message string) {
+	c.Notifiers.Notify(types.Message{Title: message, Severity: types.SeverityGood, Category: category})
 }
 
-func (c *Context) NotifyBad(message string) {
-	if c.Config.Output.Console {
-		utils.NotifyConsoleBad(message)
-	}
-
-	if c.Config.Output.Slack != nil {
-		c.DB.QueueSlackNotification(message)
-	}
-
-	if c.Config.Output.Telegram != nil {
-		c.DB.QueueTelegramNotification(message)
-	}
-
-	if c.Config.Output.Discord != nil {
-		c.DB.QueueDiscordNotification(message)
-	}
+func (c *Context) NotifyBad(category, message string) {
+	c.Notifiers.Notify(types.Message{Title: message, Severity: types.SeverityBad, Category: category})
 }
@@ -1,7 +1,9 @@
 package tasks
 
 import (
+	"context"
 	"fmt"
+	"github.com/antfie/FoxBot/types"
 	"github.com/antfie/FoxBot/utils"
 	"time"
 )
@@ -10,9 +12,9 @@ const firstRunReminderIndex = -1
 
 var currentReminderIndex = firstRunReminderIndex
 
-func (c *Context) Reminders() {
+func (c *Context) Reminders(_ context.Context) (int, error) {
 	if c.Config.Reminders.Check.Duration != nil && !utils.IsWithinDuration(time.Now(), *c.Config.Reminders.Check.Duration) {
-		return
+		return 0, nil
 	}
 
 	// Shuffle the list for the first run
@@ -26,5 +28,7 @@ func (c *Context) Reminders() {
 		currentReminderIndex = 0
 	}
 
-	c.Notify(fmt.Sprintf("🧘 %s", c.Config.Reminders.Reminders[currentReminderIndex]))
+	c.Notify(types.CategoryReminders, fmt.Sprintf("🧘 %s", c.Config.Reminders.Reminders[currentReminderIndex]))
+
+	return 1, nil
 }
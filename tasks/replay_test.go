@@ -0,0 +1,66 @@
+package tasks
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/antfie/FoxBot/db"
+	"github.com/antfie/FoxBot/integrations"
+	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
+)
+
+// recordingNotifier keeps every message sent to it
+type recordingNotifier struct {
+	mu       sync.Mutex
+	messages []types.Message
+}
+
+func (n *recordingNotifier) Name() string {
+	return "recording"
+}
+
+func (n *recordingNotifier) Capabilities() integrations.Capabilities {
+	return integrations.Capabilities{}
+}
+
+func (n *recordingNotifier) Send(message types.Message) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.messages = append(n.messages, message)
+}
+
+func (n *recordingNotifier) titles() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var titles []string
+
+	for _, m := range n.messages {
+		titles = append(titles, m.Title)
+	}
+
+	return titles
+}
+
+// replayContext answers every request from testdata/fixtures, so tasks can be tested end to end without the network
+func replayContext(t *testing.T, config *types.Config) (*Context, *recordingNotifier) {
+	t.Helper()
+
+	previous := utils.SetHttpClient(utils.NewReplayClient(types.Http{}, "testdata/fixtures"))
+	t.Cleanup(func() { utils.SetHttpClient(previous) })
+
+	notifier := &recordingNotifier{}
+
+	c := &Context{
+		Config:    config,
+		DB:        db.NewDB(":memory:"),
+		Notifiers: integrations.NewRegistry(),
+		Fetches:   utils.NewPool(2, 1),
+	}
+
+	c.Notifiers.Register(notifier, nil)
+
+	return c, notifier
+}
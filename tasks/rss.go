@@ -1,8 +1,10 @@
 package tasks
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,6 +13,7 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/antfie/FoxBot/integrations"
 	"github.com/antfie/FoxBot/types"
 	"github.com/antfie/FoxBot/utils"
 	"github.com/mmcdole/gofeed"
@@ -21,7 +24,7 @@ const daysNewsConsideredOld = 30
 var rssMutex sync.Mutex
 var rssOnce sync.Once
 
-func (c *Context) RSS() {
+func (c *Context) RSS(ctx context.Context) (int, error) {
 	rssOnce.Do(func() {
 		// Delete any old news
 		c.DB.Exec(fmt.Sprintf("DELETE FROM rss WHERE created < date('now', '-%d day')", daysNewsConsideredOld))
@@ -29,75 +32,119 @@ func (c *Context) RSS() {
 	})
 
 	if c.Config.RSS.Check.Duration != nil && !utils.IsWithinDuration(time.Now(), *c.Config.RSS.Check.Duration) {
-		return
+		return 0, nil
 	}
 
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	notified := 0
+	var errs []error
+
 	for _, feed := range c.Config.RSS.Feeds {
-		go c.processRSSFeed(feed)
+		err := c.Fetches.Go(ctx, &wg, func() {
+			count, err := c.processRSSFeed(ctx, feed)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			notified += count
+			errs = append(errs, err)
+		})
+
+		if err != nil {
+			// Cancelled, the feeds still to start are picked up on the next run
+			break
+		}
 	}
+
+	// The feeds are all finished before the task is, so runs cannot overlap
+	wg.Wait()
+
+	return notified, errors.Join(errs...)
 }
 
-func (c *Context) processRSSFeed(feed types.RSSFeed) {
-	parsedFeed, err := c.fetchFeed(feed.URL)
+// processRSSFeed returns how many items were notified
+func (c *Context) processRSSFeed(ctx context.Context, feed types.RSSFeed) (int, error) {
+	parsedFeed, err := c.fetchFeed(ctx, feed.URL)
 
 	if err != nil {
-		return
+		return 0, err
 	}
 
 	if parsedFeed == nil {
 		// 304 Not Modified
-		return
+		return 0, nil
 	}
 
+	notified := 0
+
+	muted := len(feed.Group) > 0 && c.DB.IsFeedGroupMuted(feed.Group)
+
 	for _, item := range parsedFeed.Items {
+		// Items not yet seen are picked up on the next run
+		if ctx.Err() != nil {
+			return notified, ctx.Err()
+		}
+
 		if isIgnored(feed, item, c) {
 			continue
 		}
 
-		formattedName := feed.Name
+		source := feed.Name
 		if len(feed.Group) > 0 {
-			formattedName = fmt.Sprintf("%s:%s", feed.Group, feed.Name)
+			source = fmt.Sprintf("%s:%s", feed.Group, feed.Name)
 		}
 
-		foundKeyword := utils.StringContainsWordIgnoreCase(item.Title, feed.ImportantKeywords)
-		formattedTitle := item.Title
-
-		if len(foundKeyword) > 0 {
-			formattedTitle = strings.ReplaceAll(item.Title, foundKeyword, fmt.Sprintf("*%s*", foundKeyword))
+		message := types.Message{
+			Icon:     "📰",
+			Title:    item.Title,
+			Link:     item.Link,
+			Source:   source,
+			Category: types.CategoryRSS,
+			Group:    feed.Group,
 		}
 
-		formattedLink := item.Link
+		foundKeyword := utils.StringContainsWordIgnoreCase(item.Title, feed.ImportantKeywords)
 
-		message := fmt.Sprintf("[%s]: %s - <%s>", formattedName, formattedTitle, formattedLink)
+		// Muted from chat with /mute - console only
+		if muted {
+			message.Icon = "📰 🔇"
+			utils.NotifyConsole(integrations.FormatPlain(message))
+			continue
+		}
 
 		// No title keyword found so look at the contents of the link
 		if len(foundKeyword) == 0 {
-			foundKeyword = c.processContents(feed, formattedLink)
-
-			if len(foundKeyword) > 0 {
-				message = fmt.Sprintf("[%s]: %s *%s* - <%s>", formattedName, item.Title, foundKeyword, formattedLink)
-			}
+			foundKeyword = c.processContents(ctx, feed, item.Link)
 		}
 
 		if len(foundKeyword) > 0 {
 			// Keyword match - always notify all channels
-			c.notifyRSS(fmt.Sprintf("📰 🚨 %s", message), feed.Group, item.Link, true, feed.KeywordOnly)
+			message.Icon = "📰 🚨"
+			message.Highlights = []string{foundKeyword}
+			message.Severity = types.SeverityGood
+			c.notifyRSS(message, feed.Group, feed.KeywordOnly)
+			notified++
 		} else if c.Bayes != nil && c.Bayes.IsReady(feed.Group) {
 			// Bayes has enough data - let it decide
 			score := c.Bayes.Score(feed.Group, item.Title)
 			if score > 0.5 {
-				c.notifyRSS(fmt.Sprintf("📰 %s", message), feed.Group, item.Link, false, feed.KeywordOnly)
+				c.notifyRSS(message, feed.Group, feed.KeywordOnly)
+				notified++
 			} else {
-				utils.NotifyConsole(fmt.Sprintf("📰 %s", message))
+				utils.NotifyConsole(integrations.FormatPlain(message))
 			}
 		} else {
 			// Bayes not ready - send everything for training
-			c.notifyRSS(fmt.Sprintf("📰 %s", message), feed.Group, item.Link, false, feed.KeywordOnly)
+			c.notifyRSS(message, feed.Group, feed.KeywordOnly)
+			notified++
 		}
 	}
+
+	return notified, nil
 }
 
-func (c *Context) processContents(feed types.RSSFeed, url string) string {
+func (c *Context) processContents(ctx context.Context, feed types.RSSFeed, url string) string {
 	if len(feed.HTMLContentTags) < 1 {
 		return ""
 	}
@@ -108,24 +155,28 @@ func (c *Context) processContents(feed types.RSSFeed, url string) string {
 		}
 	}
 
-	itemResponse := utils.HttpRequest("GET", url, nil, nil)
+	itemResponse := c.Fetches.HttpRequest(ctx, "GET", url, nil, nil)
 
 	if itemResponse == nil {
-		c.NotifyBad(fmt.Sprintf("RSS: Could not query %s", url))
+		if ctx.Err() != nil {
+			return ""
+		}
+
+		c.NotifyBad(types.CategoryRSS, fmt.Sprintf("RSS: Could not query %s", url))
 		return ""
 	}
 
 	defer itemResponse.Body.Close()
 
 	if itemResponse.StatusCode != http.StatusOK {
-		c.NotifyBad(fmt.Sprintf("RSS: Article (body) returned status of %s for %s", itemResponse.Status, url))
+		c.NotifyBad(types.CategoryRSS, fmt.Sprintf("RSS: Article (body) returned status of %s for %s", itemResponse.Status, url))
 		return ""
 	}
 
 	doc, err := goquery.NewDocumentFromReader(itemResponse.Body)
 
 	if err != nil {
-		c.NotifyBad(fmt.Sprintf("RSS: HTML parsing issue for %s", url))
+		c.NotifyBad(types.CategoryRSS, fmt.Sprintf("RSS: HTML parsing issue for %s", url))
 		return ""
 	}
 
@@ -144,27 +195,29 @@ func articleHash(link string) string {
 	return hex.EncodeToString(h[:5]) // 10 hex chars
 }
 
-func (c *Context) notifyRSS(message, feedGroup, link string, isGood, keywordOnly bool) {
-	if c.Config.Output.Console {
-		if isGood {
-			utils.NotifyConsoleGood(message)
-		} else {
-			utils.NotifyConsole(message)
-		}
-	}
+func (c *Context) notifyRSS(message types.Message, feedGroup string, keywordOnly bool) {
+	isGood := message.Severity == types.SeverityGood
+	hash := ""
 
-	if c.Slack != nil && (!keywordOnly || isGood) {
-		c.DB.QueueSlackNotification(message)
+	if c.Notifiers.HasFeedback() {
+		hash = articleHash(message.Link)
+		c.DB.BayesSaveArticle(hash, feedGroup, integrations.FormatPlain(message))
 	}
 
-	if c.Discord != nil && (!keywordOnly || isGood) {
-		c.DB.QueueDiscordNotification(message)
-	}
+	for _, n := range c.Notifiers.Routed(message) {
+		capabilities := n.Capabilities()
 
-	if c.Telegram != nil {
-		hash := articleHash(link)
-		c.DB.BayesSaveArticle(hash, feedGroup, message)
-		c.Telegram.SendWithFeedback(message, hash)
+		if feedbackNotifier, ok := n.(integrations.FeedbackNotifier); ok && capabilities.Buttons {
+			feedbackNotifier.SendWithFeedback(message, hash)
+			continue
+		}
+
+		// keyword_only groups only push keyword matches to channels without feedback buttons
+		if capabilities.Push && keywordOnly && !isGood {
+			continue
+		}
+
+		n.Send(message)
 	}
 }
 
@@ -191,7 +244,7 @@ func isIgnored(feed types.RSSFeed, item *gofeed.Item, c *Context) bool {
 
 const feedFailureThreshold = 10
 
-func (c *Context) fetchFeed(feedURL string) (*gofeed.Feed, error) {
+func (c *Context) fetchFeed(ctx context.Context, feedURL string) (*gofeed.Feed, error) {
 	etag, lastModified, _ := c.DB.GetHTTPCache(feedURL)
 
 	headers := map[string]string{}
@@ -204,13 +257,18 @@ func (c *Context) fetchFeed(feedURL string) (*gofeed.Feed, error) {
 		headers["If-Modified-Since"] = lastModified
 	}
 
-	response := utils.HttpRequest("GET", feedURL, headers, nil)
+	response := c.Fetches.HttpRequest(ctx, "GET", feedURL, headers, nil)
 
 	if response == nil {
+		// Stopped or timed out, so not the feed's fault
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
 		failCount := c.DB.IncrementHTTPCacheFailCount(feedURL)
 
 		if failCount == feedFailureThreshold {
-			c.NotifyBad(fmt.Sprintf("RSS feed has failed %d times: %s", failCount, feedURL))
+			c.NotifyBad(types.CategoryRSS, fmt.Sprintf("RSS feed has failed %d times: %s", failCount, feedURL))
 		}
 
 		log.Printf("Could not fetch feed: %s", feedURL)
@@ -237,7 +295,7 @@ func (c *Context) fetchFeed(feedURL string) (*gofeed.Feed, error) {
 		failCount := c.DB.IncrementHTTPCacheFailCount(feedURL)
 
 		if failCount == feedFailureThreshold {
-			c.NotifyBad(fmt.Sprintf("RSS feed has failed %d times (last status: %s): %s", failCount, response.Status, feedURL))
+			c.NotifyBad(types.CategoryRSS, fmt.Sprintf("RSS feed has failed %d times (last status: %s): %s", failCount, response.Status, feedURL))
 		}
 
 		log.Printf("RSS feed returned status %s: %s", response.Status, feedURL)
@@ -256,7 +314,7 @@ func (c *Context) fetchFeed(feedURL string) (*gofeed.Feed, error) {
 		failCount := c.DB.IncrementHTTPCacheFailCount(feedURL)
 
 		if failCount == feedFailureThreshold {
-			c.NotifyBad(fmt.Sprintf("RSS feed has failed %d times (parse error): %s", failCount, feedURL))
+			c.NotifyBad(types.CategoryRSS, fmt.Sprintf("RSS feed has failed %d times (parse error): %s", failCount, feedURL))
 		}
 
 		log.Printf("Could not parse feed: %s", feedURL)
@@ -0,0 +1,53 @@
+package tasks
+
+import (
+	"testing"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessRSSFeed(t *testing.T) {
+	c, notifier := replayContext(t, &types.Config{})
+
+	feed := types.RSSFeed{
+		Group:                 "News",
+		Name:                  "Example",
+		URL:                   "https://feeds.example.com/news.xml",
+		ImportantKeywords:     []string{"FoxBot"},
+		IgnoreURLSignatures:   []string{"/sport/"},
+		HTMLContentTags:       []string{"main"},
+		HTMLImportantKeywords: []string{"breaking news story"},
+	}
+
+	notified, err := c.processRSSFeed(t.Context(), feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, notified)
+
+	// The sport item is ignored, and the weather article only mentions the keyword outside its <main>
+	assert.Equal(t, []string{"FoxBot released", "A quiet day", "Weather update"}, notifier.titles())
+	assert.Equal(t, []string{"foxbot"}, notifier.messages[0].Highlights)
+	assert.Equal(t, []string{"breaking news story"}, notifier.messages[1].Highlights)
+	assert.Equal(t, types.SeverityGood, notifier.messages[1].Severity)
+	assert.Empty(t, notifier.messages[2].Highlights)
+	assert.Equal(t, "News:Example", notifier.messages[2].Source)
+
+	etag, lastModified, _ := c.DB.GetHTTPCache(feed.URL)
+	assert.Equal(t, `"news-v1"`, etag)
+	assert.Equal(t, "Mon, 01 Jan 2024 08:00:00 GMT", lastModified)
+
+	// Items already seen are not sent again
+	notified, err = c.processRSSFeed(t.Context(), feed)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, notified)
+	assert.Len(t, notifier.messages, 3)
+}
+
+func TestProcessRSSFeedThatCannotBeFetched(t *testing.T) {
+	c, notifier := replayContext(t, &types.Config{})
+
+	notified, err := c.processRSSFeed(t.Context(), types.RSSFeed{Name: "Missing", URL: "https://feeds.example.com/missing.xml"})
+	assert.Error(t, err)
+	assert.Equal(t, 0, notified)
+	assert.Empty(t, notifier.messages)
+}
@@ -0,0 +1,191 @@
+package tasks
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/antfie/FoxBot/types"
+)
+
+// Scheduler sleeps until the next task is due rather than polling, keeping the tasks in a heap ordered by their next run
+type Scheduler struct {
+	clock Clock
+	tasks []*Task
+	// Can be nil, in which case every start is a fresh one
+	store RunStore
+	mu    sync.Mutex
+	queue taskQueue
+	// The runs in progress
+	running sync.WaitGroup
+	// Signalled when a task finishes and is back in the queue, as it may now be the next due
+	wake chan struct{}
+}
+
+// RunStore records task runs, and when each task is next due so a restart can resume from there
+type RunStore interface {
+	SaveTaskRun(run types.TaskRun)
+	GetLastTaskRun(task string) (types.TaskRun, bool)
+	GetTaskNextRun(task string) (time.Time, bool)
+	SetTaskNextRun(task string, next time.Time)
+}
+
+func NewScheduler(tasks []*Task, clock Clock, store RunStore) *Scheduler {
+	return &Scheduler{
+		clock: clock,
+		tasks: tasks,
+		store: store,
+		wake:  make(chan struct{}, 1),
+	}
+}
+
+func (s *Scheduler) Run(ctx context.Context) {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+
+	for _, t := range s.tasks {
+		s.resume(t, now)
+		heap.Push(&s.queue, t)
+	}
+
+	s.mu.Unlock()
+
+	for s.wait(ctx) {
+		s.runDue(ctx, s.clock.Now())
+	}
+
+	s.running.Wait()
+}
+
+// resume schedules a task from its saved next run. A run missed while FoxBot was stopped happens straight away.
+func (s *Scheduler) resume(t *Task, now time.Time) {
+	// Intervals count from midnight so they run on startup, but a cron task waits for its next match
+	if t.frequency.Cron != nil {
+		t.advance(now)
+	} else {
+		t.schedule(time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()))
+	}
+
+	if s.store == nil {
+		return
+	}
+
+	if run, found := s.store.GetLastTaskRun(t.name); found {
+		t.setLastRun(run)
+	}
+
+	next, found := s.store.GetTaskNextRun(t.name)
+
+	if !found {
+		return
+	}
+
+	latest := t.scheduled()
+
+	if t.frequency.Cron == nil {
+		latest = now.Add(t.frequency.Interval)
+	}
+
+	// Saved before the frequency was shortened, so it would otherwise wait for the old one
+	if next.After(latest) {
+		return
+	}
+
+	t.schedule(next.In(now.Location()))
+}
+
+// wait sleeps until the next task is due or one finishes. It returns false once the context is cancelled.
+func (s *Scheduler) wait(ctx context.Context) bool {
+	s.mu.Lock()
+
+	if len(s.queue) == 0 {
+		s.mu.Unlock()
+
+		select {
+		case <-s.wake:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
+	delay := s.queue[0].NextExecution().Sub(s.clock.Now())
+	s.mu.Unlock()
+
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+
+	timer, stop := s.clock.NewTimer(delay)
+	defer stop()
+
+	select {
+	case <-timer:
+		return true
+	case <-s.wake:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// runDue takes every task that is due off the queue and runs it, each is put back when it finishes
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.queue) > 0 && !s.queue[0].NextExecution().After(now) {
+		t := heap.Pop(&s.queue).(*Task)
+
+		s.running.Go(func() {
+			run := t.run(ctx, s.clock)
+
+			if s.store != nil {
+				if run != nil {
+					s.store.SaveTaskRun(*run)
+				}
+
+				s.store.SetTaskNextRun(t.name, t.scheduled())
+			}
+
+			s.mu.Lock()
+			heap.Push(&s.queue, t)
+			s.mu.Unlock()
+
+			select {
+			case s.wake <- struct{}{}:
+			default:
+			}
+		})
+	}
+}
+
+// taskQueue implements heap.Interface, with the task due soonest first
+type taskQueue []*Task
+
+func (q taskQueue) Len() int {
+	return len(q)
+}
+
+func (q taskQueue) Less(i, j int) bool {
+	return q[i].NextExecution().Before(q[j].NextExecution())
+}
+
+func (q taskQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+}
+
+func (q *taskQueue) Push(x any) {
+	*q = append(*q, x.(*Task))
+}
+
+func (q *taskQueue) Pop() any {
+	old := *q
+	t := old[len(old)-1]
+	old[len(old)-1] = nil
+	*q = old[:len(old)-1]
+
+	return t
+}
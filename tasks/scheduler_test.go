@@ -0,0 +1,334 @@
+package tasks
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTimer struct {
+	at      time.Time
+	c       chan time.Time
+	stopped bool
+}
+
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) (<-chan time.Time, func() bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	timer := &fakeTimer{at: c.now.Add(d), c: make(chan time.Time, 1)}
+	c.timers = append(c.timers, timer)
+
+	return timer.c, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		stopped := !timer.stopped
+		timer.stopped = true
+
+		return stopped
+	}
+}
+
+// Advance moves the time on, firing any timers that are now due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	for _, timer := range c.timers {
+		if !timer.stopped && !timer.at.After(c.now) {
+			timer.stopped = true
+			timer.c <- c.now
+		}
+	}
+}
+
+// waitForTimer waits until the scheduler is asleep with a timer set for the given time
+func (c *fakeClock) waitForTimer(t *testing.T, at time.Time) {
+	t.Helper()
+
+	assert.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		for _, timer := range c.timers {
+			if !timer.stopped && timer.at.Equal(at) {
+				return true
+			}
+		}
+
+		return false
+	}, time.Second, time.Millisecond)
+}
+
+func nextRun(t *testing.T, runs chan string) string {
+	t.Helper()
+
+	select {
+	case name := <-runs:
+		return name
+	case <-time.After(time.Second):
+		t.Fatal("No task ran")
+		return ""
+	}
+}
+
+func waitForRun(t *testing.T, runs chan string, expected string) {
+	t.Helper()
+	assert.Equal(t, expected, nextRun(t, runs))
+}
+
+func TestSchedulerRunsTasksWhenDue(t *testing.T) {
+	// 1 January 2024 was a Monday
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)}
+	runs := make(chan string, 10)
+
+	cron, err := utils.ParseCron("0 12 * * *")
+	assert.NoError(t, err)
+
+	hourly := NewTask("hourly", types.TimeFrequencyAndDuration{Frequency: types.Frequency{Interval: time.Hour}}, func(context.Context) (int, error) {
+		clock.Advance(2 * time.Second)
+		runs <- "hourly"
+		return 0, nil
+	})
+
+	daily := NewTask("daily", types.TimeFrequencyAndDuration{Frequency: types.Frequency{Cron: cron}}, func(context.Context) (int, error) {
+		runs <- "daily"
+		return 0, nil
+	})
+
+	go NewScheduler([]*Task{hourly, daily}, clock, nil).Run(t.Context())
+
+	// Intervals run on startup, cron tasks wait for their time
+	waitForRun(t, runs, "hourly")
+	clock.waitForTimer(t, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC))
+
+	lastRun, duration := hourly.LastRun()
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC), lastRun)
+	assert.Equal(t, 2*time.Second, duration)
+	assert.Equal(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), daily.NextExecution())
+
+	// Not due yet
+	clock.Advance(30 * time.Minute)
+	assert.Empty(t, runs)
+
+	clock.Advance(15 * time.Minute)
+	waitForRun(t, runs, "hourly")
+	clock.waitForTimer(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+
+	// Both due at once, so they run side by side in either order
+	clock.Advance(time.Hour)
+	assert.ElementsMatch(t, []string{"daily", "hourly"}, []string{nextRun(t, runs), nextRun(t, runs)})
+
+	assert.Equal(t, time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC), daily.NextExecution())
+}
+
+func TestSchedulerSkipsPausedTasks(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)}
+	runs := make(chan string, 10)
+
+	task := NewTask("rss", types.TimeFrequencyAndDuration{Frequency: types.Frequency{Interval: time.Hour}}, func(context.Context) (int, error) {
+		runs <- "rss"
+		return 0, nil
+	})
+	task.Pause(time.Date(2024, 1, 1, 11, 30, 0, 0, time.UTC))
+
+	go NewScheduler([]*Task{task}, clock, nil).Run(t.Context())
+
+	// Still scheduled while paused, but does nothing
+	clock.waitForTimer(t, time.Date(2024, 1, 1, 11, 0, 0, 0, time.UTC))
+	clock.Advance(45 * time.Minute)
+	clock.waitForTimer(t, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	assert.Empty(t, runs)
+
+	clock.Advance(time.Hour)
+	waitForRun(t, runs, "rss")
+}
+
+func TestTaskJitter(t *testing.T) {
+	task := NewTask("rss", types.TimeFrequencyAndDuration{Frequency: types.Frequency{Interval: time.Hour, Jitter: 5 * time.Minute}}, func(context.Context) (int, error) { return 0, nil })
+	nominal := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for range 100 {
+		task.schedule(nominal)
+		next := task.NextExecution()
+
+		assert.False(t, next.Before(nominal))
+		assert.True(t, next.Before(nominal.Add(5*time.Minute)))
+	}
+
+	// Intervals keep counting from the scheduled time rather than the jittered one
+	task.advance(nominal.Add(time.Minute))
+	assert.Equal(t, nominal.Add(time.Hour), task.nextExecution)
+}
+
+type memoryRunStore struct {
+	mu   sync.Mutex
+	runs []types.TaskRun
+	next map[string]time.Time
+}
+
+func (s *memoryRunStore) SaveTaskRun(run types.TaskRun) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.runs = append(s.runs, run)
+}
+
+func (s *memoryRunStore) GetLastTaskRun(task string) (types.TaskRun, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if s.runs[i].Task == task {
+			return s.runs[i], true
+		}
+	}
+
+	return types.TaskRun{}, false
+}
+
+func (s *memoryRunStore) GetTaskNextRun(task string) (time.Time, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next, found := s.next[task]
+
+	return next, found
+}
+
+func (s *memoryRunStore) SetTaskNextRun(task string, next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.next[task] = next
+}
+
+func TestSchedulerResumesFromSavedState(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)}
+	runs := make(chan string, 10)
+
+	store := &memoryRunStore{
+		runs: []types.TaskRun{{Task: "rss", Started: time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC), Finished: time.Date(2024, 1, 1, 9, 30, 5, 0, time.UTC)}},
+		next: map[string]time.Time{
+			"rss": time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC),
+			// Missed while stopped
+			"weather": time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC),
+			// Saved when the frequency was daily, but it is now hourly
+			"reminders": time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	task := func(name string, err error) *Task {
+		return NewTask(name, types.TimeFrequencyAndDuration{Frequency: types.Frequency{Interval: time.Hour}}, func(context.Context) (int, error) {
+			runs <- name
+			return 3, err
+		})
+	}
+
+	rss := task("rss", errors.New("boom"))
+
+	go NewScheduler([]*Task{rss, task("weather", nil), task("reminders", nil)}, clock, store).Run(t.Context())
+
+	// Not restarted from midnight, so only the missed and the rescheduled tasks run straight away
+	assert.ElementsMatch(t, []string{"weather", "reminders"}, []string{nextRun(t, runs), nextRun(t, runs)})
+
+	lastRun, duration := rss.LastRun()
+	assert.Equal(t, time.Date(2024, 1, 1, 9, 30, 0, 0, time.UTC), lastRun)
+	assert.Equal(t, 5*time.Second, duration)
+
+	clock.waitForTimer(t, time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC))
+	clock.Advance(15 * time.Minute)
+	waitForRun(t, runs, "rss")
+
+	assert.Eventually(t, func() bool {
+		next, _ := store.GetTaskNextRun("rss")
+		return next.Equal(time.Date(2024, 1, 1, 11, 30, 0, 0, time.UTC))
+	}, time.Second, time.Millisecond)
+
+	run, _ := store.GetLastTaskRun("rss")
+	assert.Equal(t, types.TaskOutcomeFailed, run.Outcome)
+	assert.Equal(t, "boom", run.Error)
+	assert.Equal(t, 3, run.Items)
+	assert.Equal(t, time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC), run.Started)
+}
+
+func TestTaskRecordsPanics(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+
+	task := NewTask("rss", types.TimeFrequencyAndDuration{Frequency: types.Frequency{Interval: time.Hour}}, func(context.Context) (int, error) {
+		panic("oops")
+	})
+
+	run := task.run(t.Context(), clock)
+	assert.Equal(t, types.TaskOutcomePanic, run.Outcome)
+	assert.Equal(t, "oops", run.Error)
+}
+
+func TestTaskTimesOut(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+
+	task := NewTask("rss", types.TimeFrequencyAndDuration{Frequency: types.Frequency{Interval: time.Hour}, Timeout: 10 * time.Millisecond}, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 2, ctx.Err()
+	})
+
+	run := task.run(t.Context(), clock)
+	assert.Equal(t, types.TaskOutcomeTimeout, run.Outcome)
+	assert.Equal(t, 2, run.Items)
+}
+
+func TestSchedulerStopsWhenCancelled(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC)}
+	started := make(chan struct{})
+	store := &memoryRunStore{next: map[string]time.Time{}}
+
+	task := NewTask("rss", types.TimeFrequencyAndDuration{Frequency: types.Frequency{Interval: time.Hour}}, func(ctx context.Context) (int, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan struct{})
+
+	go func() {
+		NewScheduler([]*Task{task}, clock, store).Run(ctx)
+		close(done)
+	}()
+
+	<-started
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("The scheduler did not stop")
+	}
+
+	// Run waits for the task, so its run has been recorded
+	run, found := store.GetLastTaskRun("rss")
+	assert.True(t, found)
+	assert.Equal(t, types.TaskOutcomeCancelled, run.Outcome)
+}
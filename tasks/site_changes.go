@@ -1,6 +1,8 @@
 package tasks
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -23,51 +25,81 @@ var (
 	processedHashesMu sync.Mutex
 )
 
-func (c *Context) SiteChanges() {
+func (c *Context) SiteChanges(ctx context.Context) (int, error) {
 	if c.Config.SiteChanges.Check.Duration != nil && !utils.IsWithinDuration(time.Now(), *c.Config.SiteChanges.Check.Duration) {
-		return
+		return 0, nil
 	}
 
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	notified := 0
+	var errs []error
+
 	for _, site := range c.Config.SiteChanges.Sites {
-		go c.checkDifference(site)
+		err := c.Fetches.Go(ctx, &wg, func() {
+			count, err := c.checkDifference(ctx, site)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			notified += count
+			errs = append(errs, err)
+		})
+
+		if err != nil {
+			// Cancelled, the sites still to check are picked up on the next run
+			break
+		}
 	}
+
+	// The sites are all finished before the task is, so runs cannot overlap
+	wg.Wait()
+
+	return notified, errors.Join(errs...)
 }
 
-func (c *Context) checkDifference(site types.SiteChangeSite) {
-	response := utils.HttpRequest("GET", site.URL, nil, nil)
+// checkDifference returns how many changes were notified
+func (c *Context) checkDifference(ctx context.Context, site types.SiteChangeSite) (int, error) {
+	response := c.Fetches.HttpRequest(ctx, "GET", site.URL, nil, nil)
 
 	if response == nil {
-		c.NotifyBad(fmt.Sprintf("checkDifference: Could not query API %s", site.URL))
-		return
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		c.NotifyBad(types.CategorySiteChanges, fmt.Sprintf("checkDifference: Could not query API %s", site.URL))
+		return 0, fmt.Errorf("could not query %s", site.URL)
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		c.NotifyBad(fmt.Sprintf("checkDifference: API returned status of %s for %s", response.Status, site.URL))
-		return
+		c.NotifyBad(types.CategorySiteChanges, fmt.Sprintf("checkDifference: API returned status of %s for %s", response.Status, site.URL))
+		return 0, fmt.Errorf("status %s for %s", response.Status, site.URL)
 	}
 
 	body, err := io.ReadAll(response.Body)
 
 	if err != nil {
 		log.Print(err)
-		return
+		return 0, err
 	}
 
 	if len(site.ConnectionSuccessSignature) > 0 {
 		if !strings.Contains(string(body), site.ConnectionSuccessSignature) {
-			c.NotifyGood(fmt.Sprintf("Could not find success signature in response for URL: %s", site.URL))
-			return
+			c.NotifyGood(types.CategorySiteChanges, fmt.Sprintf("Could not find success signature in response for URL: %s", site.URL))
+			return 1, nil
 		}
 	}
 
 	bodyString := string(body)
+	notified := 0
 
 	if len(site.KeywordsToFind) > 0 {
 		foundKeyword := utils.StringContainsWordIgnoreCase(bodyString, site.KeywordsToFind)
 		if len(foundKeyword) > 0 {
-			c.NotifyGood(fmt.Sprintf("Keyword \"%s\" found for URL: %s", foundKeyword, site.URL))
+			c.NotifyGood(types.CategorySiteChanges, fmt.Sprintf("Keyword \"%s\" found for URL: %s", foundKeyword, site.URL))
+			notified++
 		}
 	}
 
@@ -75,38 +107,44 @@ func (c *Context) checkDifference(site types.SiteChangeSite) {
 		lowerCaseBody := strings.ToLower(bodyString)
 		for _, phrase := range site.PhrasesThatMightChange {
 			if !strings.Contains(lowerCaseBody, strings.ToLower(phrase)) {
-				c.NotifyGood(fmt.Sprintf("Phrase \"%s\" not found for URL: %s", phrase, site.URL))
+				c.NotifyGood(types.CategorySiteChanges, fmt.Sprintf("Phrase \"%s\" not found for URL: %s", phrase, site.URL))
+				notified++
 			}
 		}
 	}
 
-	c.detectHashChanges(site, body)
+	if c.detectHashChanges(site, body) {
+		notified++
+	}
+
+	return notified, nil
 }
 
-func (c *Context) detectHashChanges(site types.SiteChangeSite, body []byte) {
+// detectHashChanges reports whether a change was notified
+func (c *Context) detectHashChanges(site types.SiteChangeSite, body []byte) bool {
 	if len(site.Hash) < 1 {
-		return
+		return false
 	}
 
 	hash, err := crypto.HashDataToString(body)
 
 	if err != nil {
 		log.Print(err)
-		return
+		return false
 	}
 
 	if hash == site.Hash {
-		return
+		return false
 	}
 
 	processedHashesMu.Lock()
 	defer processedHashesMu.Unlock()
 
 	if _, seen := processedHashes[hash]; seen {
-		return
+		return false
 	}
 
-	c.NotifyGood(fmt.Sprintf("Body is different for URL: %s: %s", site.URL, hash))
+	c.NotifyGood(types.CategorySiteChanges, fmt.Sprintf("Body is different for URL: %s: %s", site.URL, hash))
 
 	err = os.WriteFile(path.Clean(path.Join("data", hash)), body, 0600)
 
@@ -119,4 +157,6 @@ func (c *Context) detectHashChanges(site types.SiteChangeSite, body []byte) {
 	}
 
 	processedHashes[hash] = struct{}{}
+
+	return true
 }
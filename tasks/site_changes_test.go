@@ -0,0 +1,52 @@
+package tasks
+
+import (
+	"testing"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckDifference(t *testing.T) {
+	c, notifier := replayContext(t, &types.Config{})
+
+	notified, err := c.checkDifference(t.Context(), types.SiteChangeSite{
+		URL:                        "https://status.example.com/status",
+		ConnectionSuccessSignature: "operational",
+		KeywordsToFind:             []string{"Maintenance"},
+		PhrasesThatMightChange:     []string{"No incidents", "all systems operational"},
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, notified)
+	assert.Equal(t, []string{
+		`Keyword "maintenance" found for URL: https://status.example.com/status`,
+		`Phrase "No incidents" not found for URL: https://status.example.com/status`,
+	}, notifier.titles())
+}
+
+func TestCheckDifferenceMissingSignature(t *testing.T) {
+	c, notifier := replayContext(t, &types.Config{})
+
+	notified, err := c.checkDifference(t.Context(), types.SiteChangeSite{
+		URL:                        "https://status.example.com/status",
+		ConnectionSuccessSignature: "Welcome back",
+		KeywordsToFind:             []string{"Maintenance"},
+	})
+
+	// Nothing else is checked when the page isn't the one expected
+	assert.NoError(t, err)
+	assert.Equal(t, 1, notified)
+	assert.Equal(t, []string{"Could not find success signature in response for URL: https://status.example.com/status"}, notifier.titles())
+}
+
+func TestCheckDifferenceBadStatus(t *testing.T) {
+	c, notifier := replayContext(t, &types.Config{})
+
+	notified, err := c.checkDifference(t.Context(), types.SiteChangeSite{URL: "https://status.example.com/down"})
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, notified)
+	assert.Equal(t, []string{"checkDifference: API returned status of 503 Service Unavailable for https://status.example.com/down"}, notifier.titles())
+	assert.Equal(t, types.SeverityBad, notifier.messages[0].Severity)
+}
@@ -1,67 +1,206 @@
 package tasks
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"math/rand/v2"
 	"runtime"
 	"sync"
 	"time"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/antfie/FoxBot/utils"
 )
 
 type Task struct {
-	mu            sync.Mutex
+	mu        sync.Mutex
+	name      string
+	frequency types.Frequency
+	timeout   time.Duration
+	// Returns how many notifications the run raised
+	action  func(ctx context.Context) (int, error)
+	stateMu sync.Mutex
+	// When the task is scheduled, which intervals are counted from
 	nextExecution time.Time
-	interval      time.Duration
-	action        func()
+	// When the task will actually run, which is nextExecution plus any jitter
+	nextRun      time.Time
+	lastRun      time.Time
+	lastDuration time.Duration
+	pausedUntil  time.Time
 }
 
-func NewTask(interval time.Duration, action func()) *Task {
+// defaultTaskTimeout stops a hung run from holding a task up forever when no timeout is configured
+const defaultTaskTimeout = 10 * time.Minute
+
+func NewTask(name string, check types.TimeFrequencyAndDuration, action func(ctx context.Context) (int, error)) *Task {
+	timeout := check.Timeout
+
+	if timeout <= 0 {
+		timeout = defaultTaskTimeout
+	}
+
 	return &Task{
+		name:          name,
 		nextExecution: time.Time{},
-		interval:      interval,
+		frequency:     check.Frequency,
+		timeout:       timeout,
 		action:        action,
 	}
 }
 
-func Run(tasks []*Task) {
-	now := time.Now()
-	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+func (t *Task) Name() string {
+	return t.name
+}
+
+func (t *Task) NextExecution() time.Time {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	return t.nextRun
+}
+
+// LastRun returns when the task last started and how long it took, or the zero time if it has not run yet
+func (t *Task) LastRun() (time.Time, time.Duration) {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	return t.lastRun, t.lastDuration
+}
+
+// Pause stops the task from running until the given time. Runs missed while paused are skipped.
+func (t *Task) Pause(until time.Time) {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	t.pausedUntil = until
+}
 
-	for i := range tasks {
-		tasks[i].nextExecution = startOfDay
+func (t *Task) Resume() {
+	t.Pause(time.Time{})
+}
+
+func (t *Task) PausedUntil() time.Time {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	return t.pausedUntil
+}
+
+func (t *Task) isPaused(now time.Time) bool {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	return now.Before(t.pausedUntil)
+}
+
+// scheduled returns when the task is next due, without any jitter
+func (t *Task) scheduled() time.Time {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	return t.nextExecution
+}
+
+// schedule sets when the task next runs, adding a random delay of up to the task's jitter
+func (t *Task) schedule(next time.Time) {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	t.nextExecution = next
+	t.nextRun = next
+
+	if t.frequency.Jitter > 0 {
+		t.nextRun = next.Add(rand.N(t.frequency.Jitter))
 	}
+}
 
-	for {
-		now = time.Now()
-
-		for i := range tasks {
-			go func(t *Task) {
-				// Skip if the previous execution is still running
-				if !t.mu.TryLock() {
-					return
-				}
-				defer t.mu.Unlock()
-
-				defer func() {
-					if r := recover(); r != nil {
-						buf := make([]byte, 1024)
-						stackSize := runtime.Stack(buf, false)
-						stackTrace := string(buf[:stackSize])
-						log.Printf("Task panic recovered: %v\nStack trace:\n%s", r, stackTrace)
-					}
-				}()
-
-				if now.Equal(t.nextExecution) || now.After(t.nextExecution) {
-					t.action()
-
-					postExecuteTime := time.Now()
-
-					for postExecuteTime.After(t.nextExecution) {
-						t.nextExecution = t.nextExecution.Add(t.interval)
-					}
-				}
-			}(tasks[i])
+// advance schedules the first run after now, skipping any that were missed
+func (t *Task) advance(now time.Time) {
+	if t.frequency.Cron != nil {
+		t.schedule(utils.NextCronTime(*t.frequency.Cron, now))
+		return
+	}
+
+	next := t.scheduled()
+
+	for !next.After(now) {
+		next = next.Add(t.frequency.Interval)
+	}
+
+	t.schedule(next)
+}
+
+// run runs the task unless it is paused, then schedules the next run. It returns nil if the task did not run.
+func (t *Task) run(ctx context.Context, clock Clock) *types.TaskRun {
+	// Skip if the previous execution is still running
+	if !t.mu.TryLock() {
+		return nil
+	}
+	defer t.mu.Unlock()
+
+	var run *types.TaskRun
+
+	if !t.isPaused(clock.Now()) {
+		run = t.execute(ctx, clock)
+	}
+
+	t.advance(clock.Now())
+
+	return run
+}
+
+func (t *Task) execute(ctx context.Context, clock Clock) (run *types.TaskRun) {
+	run = &types.TaskRun{Task: t.name, Started: clock.Now(), Outcome: types.TaskOutcomeSuccess}
+
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+
+	defer func() {
+		if r := recover(); r != nil {
+			buf := make([]byte, 1024)
+			stackSize := runtime.Stack(buf, false)
+			stackTrace := string(buf[:stackSize])
+			log.Printf("Task panic recovered: %v\nStack trace:\n%s", r, stackTrace)
+
+			run.Outcome = types.TaskOutcomePanic
+			run.Error = fmt.Sprint(r)
 		}
 
-		time.Sleep(time.Second)
+		run.Finished = clock.Now()
+		t.setLastRun(*run)
+	}()
+
+	items, err := t.action(ctx)
+	run.Items = items
+
+	if err != nil {
+		run.Outcome = types.TaskOutcomeFailed
+		run.Error = err.Error()
+	}
+
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		log.Printf("Task %s timed out after %s", t.name, t.timeout)
+		run.Outcome = types.TaskOutcomeTimeout
+	case errors.Is(ctx.Err(), context.Canceled):
+		run.Outcome = types.TaskOutcomeCancelled
 	}
+
+	return run
+}
+
+func (t *Task) setLastRun(run types.TaskRun) {
+	t.stateMu.Lock()
+	defer t.stateMu.Unlock()
+
+	t.lastRun = run.Started
+	t.lastDuration = run.Finished.Sub(run.Started)
+}
+
+// Run schedules the tasks until the context is cancelled, recording each run and picking up where the last
+// one left off. Cancelling also cancels the runs in progress, and Run returns once they have finished.
+func Run(ctx context.Context, tasks []*Task, store RunStore) {
+	NewScheduler(tasks, realClock{}, store).Run(ctx)
 }
@@ -1,12 +1,13 @@
 package tasks
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/antfie/FoxBot/types"
@@ -27,75 +28,111 @@ type openMeteoResponse struct {
 	} `json:"hourly"`
 }
 
-func (c *Context) Weather() {
+func (c *Context) Weather(ctx context.Context) (int, error) {
 	if c.Config.Weather.Check.Duration != nil && !utils.IsWithinDuration(time.Now(), *c.Config.Weather.Check.Duration) {
-		return
+		return 0, nil
 	}
 
+	notified := 0
+	var errs []error
+
 	for _, location := range c.Config.Weather.Locations {
-		c.fetchWeather(location)
+		if ctx.Err() != nil {
+			errs = append(errs, ctx.Err())
+			break
+		}
+
+		sent, err := c.fetchWeather(ctx, location)
+
+		if sent {
+			notified++
+		}
+
+		errs = append(errs, err)
 	}
+
+	return notified, errors.Join(errs...)
 }
 
-func (c *Context) fetchWeather(location types.WeatherLocation) {
+// errIncompleteWeather is logged rather than notified, the API usually recovers by the next check
+var errIncompleteWeather = errors.New("incomplete weather data")
+
+// fetchWeather reports whether the forecast was sent
+func (c *Context) fetchWeather(ctx context.Context, location types.WeatherLocation) (bool, error) {
 	if c.DB.HasWeatherBeenNotifiedToday(location.Name) {
-		return
+		return false, nil
+	}
+
+	message, err := c.forecast(ctx, location)
+
+	if errors.Is(err, errIncompleteWeather) {
+		log.Printf("Weather: %v", err)
+		return false, err
+	}
+
+	// Stopped or timed out, which is not the API's fault
+	if ctx.Err() != nil {
+		return false, ctx.Err()
+	}
+
+	if err != nil {
+		c.NotifyBad(types.CategoryWeather, fmt.Sprintf("Weather: %v", err))
+		return false, err
 	}
 
+	c.Notifiers.Notify(message)
+	c.DB.SetWeatherNotified(location.Name)
+
+	return true, nil
+}
+
+func (c *Context) forecast(ctx context.Context, location types.WeatherLocation) (types.Message, error) {
 	url := fmt.Sprintf(
 		"https://api.open-meteo.com/v1/forecast?latitude=%.4f&longitude=%.4f&daily=temperature_2m_max,temperature_2m_min,precipitation_probability_max,weather_code,wind_speed_10m_max&hourly=temperature_2m,weather_code&timezone=auto&forecast_days=1",
 		location.Latitude,
 		location.Longitude,
 	)
 
-	response := utils.HttpRequest("GET", url, nil, nil)
+	response := utils.HttpRequestWithContext(ctx, "GET", url, nil, nil)
 
 	if response == nil {
-		c.NotifyBad(fmt.Sprintf("Weather: Could not query API for %s", location.Name))
-		return
+		return types.Message{}, fmt.Errorf("could not query API for %s", location.Name)
 	}
 
 	defer response.Body.Close()
 
 	if response.StatusCode != http.StatusOK {
-		c.NotifyBad(fmt.Sprintf("Weather: API returned status %s for %s", response.Status, location.Name))
-		return
+		return types.Message{}, fmt.Errorf("API returned status %s for %s", response.Status, location.Name)
 	}
 
 	body, err := io.ReadAll(response.Body)
 
 	if err != nil {
-		log.Print(err)
-		return
+		return types.Message{}, err
 	}
 
 	var data openMeteoResponse
 	err = json.Unmarshal(body, &data)
 
 	if err != nil {
-		log.Printf("Weather: Could not parse response for %s: %v", location.Name, err)
-		return
+		return types.Message{}, fmt.Errorf("%w: could not parse response for %s: %v", errIncompleteWeather, location.Name, err)
 	}
 
 	if len(data.Daily.TemperatureMax) < 1 || len(data.Daily.TemperatureMin) < 1 ||
 		len(data.Daily.PrecipitationProbMax) < 1 || len(data.Daily.WeatherCode) < 1 ||
 		len(data.Daily.WindSpeedMax) < 1 {
-		log.Printf("Weather: Incomplete data for %s", location.Name)
-		return
+		return types.Message{}, fmt.Errorf("%w for %s", errIncompleteWeather, location.Name)
 	}
 
 	if len(data.Hourly.Temperature) < 24 || len(data.Hourly.WeatherCode) < 24 {
-		log.Printf("Weather: Incomplete hourly data for %s", location.Name)
-		return
+		return types.Message{}, fmt.Errorf("%w (hourly) for %s", errIncompleteWeather, location.Name)
 	}
 
-	message := formatWeatherForecast(location.Name, data)
-
-	c.Notify(message)
-	c.DB.SetWeatherNotified(location.Name)
+	return weatherForecast(location.Name, data), nil
 }
 
-func formatWeatherForecast(name string, data openMeteoResponse) string {
+// weatherForecast has the day's range as the title, and a field for each part of the day, the wind and the rain
+func weatherForecast(name string, data openMeteoResponse) types.Message {
 	emoji := weatherCodeToEmoji(data.Daily.WeatherCode[0])
 
 	// Hourly indices: 8=8am (morning), 13=1pm (afternoon), 19=7pm (evening)
@@ -108,21 +145,29 @@ func formatWeatherForecast(name string, data openMeteoResponse) string {
 		{"Evening", 19},
 	}
 
-	var sb strings.Builder
-
-	fmt.Fprintf(&sb, "%s %s: %.0f°C to %.0f°C\n", emoji, name,
-		data.Daily.TemperatureMin[0], data.Daily.TemperatureMax[0])
+	message := types.Message{
+		Icon:     emoji,
+		Title:    fmt.Sprintf("%s: %.0f°C to %.0f°C", name, data.Daily.TemperatureMin[0], data.Daily.TemperatureMax[0]),
+		Severity: types.SeverityInfo,
+		Category: types.CategoryWeather,
+	}
 
 	for _, p := range periods {
 		pEmoji := weatherCodeToEmoji(data.Hourly.WeatherCode[p.hour])
 		pCondition := weatherCodeToDescription(data.Hourly.WeatherCode[p.hour])
-		fmt.Fprintf(&sb, "  %s: %s %s, %.0f°C\n", p.label, pEmoji, pCondition, data.Hourly.Temperature[p.hour])
+
+		message.Fields = append(message.Fields, types.MessageField{
+			Name:  p.label,
+			Value: fmt.Sprintf("%s %s, %.0f°C", pEmoji, pCondition, data.Hourly.Temperature[p.hour]),
+		})
 	}
 
-	fmt.Fprintf(&sb, "  Wind: up to %.0f km/h | Rain: %d%% chance",
-		data.Daily.WindSpeedMax[0], data.Daily.PrecipitationProbMax[0])
+	message.Fields = append(message.Fields,
+		types.MessageField{Name: "Wind", Value: fmt.Sprintf("up to %.0f km/h", data.Daily.WindSpeedMax[0])},
+		types.MessageField{Name: "Rain", Value: fmt.Sprintf("%d%% chance", data.Daily.PrecipitationProbMax[0])},
+	)
 
-	return sb.String()
+	return message
 }
 
 func weatherCodeToDescription(code int) string {
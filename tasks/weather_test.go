@@ -3,6 +3,8 @@ package tasks
 import (
 	"testing"
 
+	"github.com/antfie/FoxBot/integrations"
+	"github.com/antfie/FoxBot/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -55,13 +57,41 @@ func TestFormatWeatherForecast(t *testing.T) {
 	data.Hourly.Temperature = hourlyTemps
 	data.Hourly.WeatherCode = hourlyCodes
 
-	result := formatWeatherForecast("Manchester", data)
+	message := weatherForecast("Manchester", data)
 
-	expected := "☀️ Manchester: 12°C to 18°C\n" +
-		"  Morning: 🌤️ Partly cloudy, 14°C\n" +
-		"  Afternoon: ☀️ Clear sky, 18°C\n" +
-		"  Evening: 🌧️ Moderate rain, 15°C\n" +
-		"  Wind: up to 25 km/h | Rain: 30% chance"
+	assert.Equal(t, "☀️", message.Icon)
+	assert.Equal(t, "Manchester: 12°C to 18°C", message.Title)
+	assert.Equal(t, types.CategoryWeather, message.Category)
+	assert.Equal(t, []types.MessageField{
+		{Name: "Morning", Value: "🌤️ Partly cloudy, 14°C"},
+		{Name: "Afternoon", Value: "☀️ Clear sky, 18°C"},
+		{Name: "Evening", Value: "🌧️ Moderate rain, 15°C"},
+		{Name: "Wind", Value: "up to 25 km/h"},
+		{Name: "Rain", Value: "30% chance"},
+	}, message.Fields)
+}
+
+func TestFetchWeather(t *testing.T) {
+	c, notifier := replayContext(t, &types.Config{})
+	location := types.WeatherLocation{Name: "Manchester", Latitude: 53.4781, Longitude: -2.2447}
+
+	sent, err := c.fetchWeather(t.Context(), location)
+	assert.NoError(t, err)
+	assert.True(t, sent)
+
+	assert.Equal(t, []string{"Manchester: 3°C to 9°C"}, notifier.titles())
+
+	expected := "🌧️ Manchester: 3°C to 9°C\n" +
+		"Morning: 🌤️ Partly cloudy, 5°C\n" +
+		"Afternoon: 🌧️ Slight rain, 9°C\n" +
+		"Evening: 🌤️ Overcast, 6°C\n" +
+		"Wind: up to 25 km/h\n" +
+		"Rain: 65% chance"
+
+	assert.Equal(t, expected, integrations.FormatPlain(notifier.messages[0]))
 
-	assert.Equal(t, expected, result)
+	// Once a day
+	sent, err = c.fetchWeather(t.Context(), location)
+	assert.NoError(t, err)
+	assert.False(t, sent)
 }
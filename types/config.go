@@ -1,9 +1,17 @@
 package types
 
+import (
+	"crypto/x509"
+	"net/url"
+	"time"
+)
+
 type Config struct {
 	CheckForNewVersions bool
 	DBPath              string
 	LogPath             string
+	Concurrency         Concurrency
+	Http                Http
 	Output              Output
 	Reminders           *Reminders
 	Countdown           *Countdown
@@ -12,26 +20,142 @@ type Config struct {
 	Weather             *Weather
 }
 
+// Concurrency limits the fetches made by the RSS and site change tasks
+type Concurrency struct {
+	// How many feeds and sites are fetched at once
+	Workers int
+	// How many requests can be made to one host at once
+	PerHost int
+}
+
+// Http configures the client every request is made with
+type Http struct {
+	// Used instead of the HTTP_PROXY and HTTPS_PROXY environment variables
+	Proxy *url.URL
+	// Trusted as well as the system certificates, for self-hosted services
+	RootCAs   *x509.CertPool
+	UserAgent string
+	Timeout   time.Duration
+	// How many times a failed request is retried, nil uses the default
+	Retries       *int
+	RetryDelay    time.Duration
+	MaxRetryDelay time.Duration
+	// Bodies larger than this fail to read, in bytes
+	MaxResponseSize int64
+	// Settings for particular hosts, by host name
+	Hosts map[string]HttpHost
+}
+
+type HttpHost struct {
+	UserAgent string
+	Headers   map[string]string
+	Cookies   map[string]string
+	// Sent as basic auth when set
+	Username string
+	Password string
+}
+
 type Output struct {
 	Console  bool
 	Slack    *Slack
 	Telegram *Telegram
 	Discord  *Discord
+	Matrix   *Matrix
+	Ntfy     *Ntfy
+	Gotify   *Gotify
+	Email    *Email
+	Webhooks []Webhook
 }
 
 type Slack struct {
 	Token     string
 	ChannelId string
-	Duration  *TimeDuration
+	// Enables 👍/👎 feedback buttons, verified with the Slack app's signing secret
+	SigningSecret string
+	ListenAddress string
+	Duration      *TimeDuration
+	Routes        []Route
 }
 
 type Telegram struct {
 	Token    string
 	ChatID   string
 	Duration *TimeDuration
+	Routes   []Route
+}
+
+type Matrix struct {
+	// The homeserver's base URL, such as https://matrix.org
+	Homeserver  string
+	AccessToken string
+	RoomID      string
+	Duration    *TimeDuration
+	Routes      []Route
+}
+
+type Ntfy struct {
+	Server string
+	Topic  string
+	// Optional access token for protected topics
+	Token    string
+	Duration *TimeDuration
+	Routes   []Route
+}
+
+type Gotify struct {
+	Server string
+	// The application token
+	Token    string
+	Duration *TimeDuration
+	Routes   []Route
+}
+
+// Route selects the notifications an output receives. Each list matches anything when empty, and a notification
+// must match all three lists.
+type Route struct {
+	// Categories, which are named after the tasks, see CategoryRSS etc.
+	Tasks      []string
+	Groups     []string
+	Severities []Severity
+}
+
+type Email struct {
+	Host string
+	Port int
+	// starttls, tls (implicit TLS) or none
+	Security   string
+	Username   string
+	Password   string
+	Sender     string
+	Recipients []string
+	Subject    string
+	// When set notifications are collected and sent as one digest email at this time each day
+	DigestAt *time.Time
+	// The timezone of the digest time, nil for the local time
+	Location *time.Location
+	Duration *TimeDuration
+	Routes   []Route
+}
+
+type Webhook struct {
+	Name    string
+	URL     string
+	Method  string
+	Headers map[string]string
+	// A text/template for the request body, rendered with each notification
+	Template string
+	// When set the body is signed with HMAC-SHA256 and sent in SignatureHeader
+	Secret          string
+	SignatureHeader string
+	Duration        *TimeDuration
+	Routes          []Route
 }
 
 type Discord struct {
 	WebhookURL string
-	Duration   *TimeDuration
+	// A bot token and channel enable 👍/👎 reactions for feedback instead of posting via the webhook
+	Token     string
+	ChannelID string
+	Duration  *TimeDuration
+	Routes    []Route
 }
@@ -0,0 +1,34 @@
+package types
+
+// Message is a notification as the tasks produce it. Each output renders it in its own format.
+type Message struct {
+	// Leading emoji such as 📰
+	Icon  string
+	Title string
+	Link  string
+	// Where the message came from, such as the RSS feed
+	Source string
+	// Terms to emphasise, such as matched keywords. Terms not found in the title are shown after it.
+	Highlights []string
+	Severity   Severity
+	Fields     []MessageField
+	// The task that raised the message, such as rss or weather, used to group digests
+	Category string
+	// The RSS feed group
+	Group string
+}
+
+// Categories are named after the tasks, plus foxbot for FoxBot's own start and stop messages
+const (
+	CategoryFoxBot      = "foxbot"
+	CategoryReminders   = "reminders"
+	CategoryCountdown   = "countdown"
+	CategoryRSS         = "rss"
+	CategorySiteChanges = "site_changes"
+	CategoryWeather     = "weather"
+)
+
+type MessageField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
@@ -0,0 +1,18 @@
+package types
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityGood
+	SeverityBad
+)
+
+type QueuedNotification struct {
+	ID       int64
+	Severity Severity
+	Payload  string
+	// Set for RSS items that are sent with feedback buttons, whose payload is the message as JSON
+	ArticleHash string
+	Attempts    int
+}
@@ -0,0 +1,24 @@
+package types
+
+import "time"
+
+const (
+	TaskOutcomeSuccess = "success"
+	TaskOutcomeFailed  = "failed"
+	TaskOutcomePanic   = "panic"
+	// The run went past the task's timeout
+	TaskOutcomeTimeout = "timeout"
+	// FoxBot stopped during the run
+	TaskOutcomeCancelled = "cancelled"
+)
+
+// TaskRun records one run of a scheduled task
+type TaskRun struct {
+	Task     string
+	Started  time.Time
+	Finished time.Time
+	Outcome  string
+	Error    string
+	// How many notifications the run raised
+	Items int
+}
@@ -3,11 +3,46 @@ package types
 import "time"
 
 type TimeFrequencyAndDuration struct {
-	Frequency time.Duration
+	Frequency Frequency
 	Duration  *TimeDuration
+	// How long a run may take before it is cancelled
+	Timeout time.Duration
 }
 
+// Frequency is how often a task runs, either every Interval or whenever Cron matches
+type Frequency struct {
+	Interval time.Duration
+	Cron     *CronSchedule
+	// Each run is delayed by a random amount up to this, to spread requests out
+	Jitter time.Duration
+}
+
+// CronSchedule is a parsed 5-field cron expression, with each field a bitmask of the values it matches
+type CronSchedule struct {
+	Expression  string
+	Minutes     uint64
+	Hours       uint64
+	DaysOfMonth uint64
+	Months      uint64
+	DaysOfWeek  uint64
+	// As in standard cron, when both day fields are restricted a day matching either will do
+	AnyDayOfMonth bool
+	AnyDayOfWeek  bool
+	// The timezone the expression is in, nil for the local time
+	Location *time.Location
+}
+
+// TimeDuration is open whenever the time falls in one of its windows
 type TimeDuration struct {
+	Windows []TimeWindow
+	// The timezone the windows are in, nil for the local time
+	Location *time.Location
+}
+
+// TimeWindow runs from From to To, and overnight when To is earlier than From
+type TimeWindow struct {
 	From time.Time
 	To   time.Time
+	// The days the window opens on, empty for every day. An overnight window belongs to the day it opens.
+	Days []time.Weekday
 }
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/antfie/FoxBot/types"
+)
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+	// 7 is also Sunday
+	{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+}
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a standard 5-field cron expression such as "30 7 * * 1-5". Fields accept *, lists, ranges,
+// steps and the names of months and days.
+func ParseCron(expression string) (*types.CronSchedule, error) {
+	spec := strings.TrimSpace(expression)
+
+	if macro, found := cronMacros[strings.ToLower(spec)]; found {
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+
+	if len(fields) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q needs 5 fields, got %d", expression, len(fields))
+	}
+
+	masks := make([]uint64, len(fields))
+
+	for i, field := range fields {
+		mask, err := parseCronField(field, cronFields[i])
+
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", expression, err)
+		}
+
+		masks[i] = mask
+	}
+
+	// Fold 7 into 0 so Sunday has one bit
+	if masks[4]&(1<<7) != 0 {
+		masks[4] = masks[4]&^(1<<7) | 1
+	}
+
+	return &types.CronSchedule{
+		Expression:    expression,
+		Minutes:       masks[0],
+		Hours:         masks[1],
+		DaysOfMonth:   masks[2],
+		Months:        masks[3],
+		DaysOfWeek:    masks[4],
+		AnyDayOfMonth: strings.HasPrefix(fields[2], "*"),
+		AnyDayOfWeek:  strings.HasPrefix(fields[4], "*"),
+	}, nil
+}
+
+func parseCronField(value string, field cronField) (uint64, error) {
+	var mask uint64
+
+	for _, part := range strings.Split(value, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid %s step %q", field.name, stepPart)
+			}
+		}
+
+		first, last := field.min, field.max
+
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+
+			if first, err = parseCronValue(from, field); err != nil {
+				return 0, err
+			}
+
+			last = first
+
+			if isRange {
+				if last, err = parseCronValue(to, field); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				// As in standard cron, 5/15 means from 5 onwards every 15
+				last = field.max
+			}
+
+			if last < first {
+				return 0, fmt.Errorf("invalid %s range %q", field.name, rangePart)
+			}
+		}
+
+		for i := first; i <= last; i += step {
+			mask |= 1 << i
+		}
+	}
+
+	return mask, nil
+}
+
+func parseCronValue(value string, field cronField) (int, error) {
+	for i, name := range field.names {
+		if strings.EqualFold(value, name) {
+			return i + field.min, nil
+		}
+	}
+
+	number, err := strconv.Atoi(value)
+
+	if err != nil || number < field.min || number > field.max {
+		return 0, fmt.Errorf("invalid %s %q", field.name, value)
+	}
+
+	return number, nil
+}
+
+// NextCronTime returns the first time after the given time that the schedule matches,
+// or the zero time if it never does, such as on 30 February.
+func NextCronTime(schedule types.CronSchedule, after time.Time) time.Time {
+	if schedule.Location != nil {
+		after = after.In(schedule.Location)
+	}
+
+	location := after.Location()
+	t := after.Truncate(time.Minute).Add(time.Minute)
+
+	// Jump a field at a time rather than checking every minute. Every schedule repeats within 5 years, taking leap years into account.
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		if schedule.Months&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+
+		if !cronDayMatches(schedule, t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+			continue
+		}
+
+		if schedule.Hours&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, location)
+			continue
+		}
+
+		if schedule.Minutes&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+
+		return t
+	}
+
+	return time.Time{}
+}
+
+func cronDayMatches(schedule types.CronSchedule, t time.Time) bool {
+	dayOfMonth := schedule.DaysOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := schedule.DaysOfWeek&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case schedule.AnyDayOfMonth && schedule.AnyDayOfWeek:
+		return true
+	case schedule.AnyDayOfMonth:
+		return dayOfWeek
+	case schedule.AnyDayOfWeek:
+		return dayOfMonth
+	default:
+		return dayOfMonth || dayOfWeek
+	}
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func nextCron(t *testing.T, expression string, after time.Time) time.Time {
+	t.Helper()
+	schedule, err := ParseCron(expression)
+	assert.NoError(t, err)
+
+	return NextCronTime(*schedule, after)
+}
+
+func TestNextCronTime(t *testing.T) {
+	// 1 January 2024 was a Monday
+	monday := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2024, 1, 1, 12, 1, 0, 0, time.UTC), nextCron(t, "* * * * *", monday))
+	assert.Equal(t, time.Date(2024, 1, 1, 12, 15, 0, 0, time.UTC), nextCron(t, "*/15 * * * *", monday))
+	assert.Equal(t, time.Date(2024, 1, 2, 7, 30, 0, 0, time.UTC), nextCron(t, "30 7 * * 1-5", monday))
+	assert.Equal(t, time.Date(2024, 1, 6, 9, 0, 0, 0, time.UTC), nextCron(t, "0 9 * * sat,sun", monday))
+	assert.Equal(t, time.Date(2024, 1, 7, 0, 0, 0, 0, time.UTC), nextCron(t, "0 0 * * 7", monday))
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), nextCron(t, "@monthly", monday))
+	assert.Equal(t, time.Date(2024, 2, 29, 8, 0, 0, 0, time.UTC), nextCron(t, "0 8 29 feb *", monday))
+	assert.Equal(t, time.Date(2024, 1, 1, 18, 5, 0, 0, time.UTC), nextCron(t, "5 18-20/2 * * *", monday))
+
+	// Both day fields restricted, so either matches: the 15th or a Friday
+	assert.Equal(t, time.Date(2024, 1, 5, 0, 0, 0, 0, time.UTC), nextCron(t, "0 0 15 * fri", monday))
+
+	// Strictly after, never the time given
+	assert.Equal(t, time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC), nextCron(t, "0 12 * * *", monday))
+
+	// Never runs
+	assert.True(t, nextCron(t, "0 0 30 feb *", monday).IsZero())
+}
+
+func TestNextCronTimeLocation(t *testing.T) {
+	schedule, err := ParseCron("0 9 * * *")
+	assert.NoError(t, err)
+
+	schedule.Location = time.FixedZone("UTC+10", 10*60*60)
+
+	// 09:00 in UTC+10 is 23:00 UTC the day before
+	next := NextCronTime(*schedule, time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC))
+	assert.True(t, time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC).Equal(next))
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "* * * foo *"} {
+		_, err := ParseCron(expression)
+		assert.Error(t, err, expression)
+	}
+}
@@ -1,52 +1,287 @@
 package utils
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
 	"io"
 	"log"
+	"math/rand/v2"
 	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"time"
+
+	"github.com/antfie/FoxBot/types"
+)
+
+const (
+	defaultUserAgent       = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:124.0) Gecko/20100101 Firefox/124.0"
+	defaultHttpTimeout     = 30 * time.Second
+	defaultHttpRetries     = 4
+	defaultRetryDelay      = 2 * time.Second
+	defaultMaxRetryDelay   = 30 * time.Second
+	defaultMaxResponseSize = 10 << 20
 )
 
+// Methods that can be sent again without doing something twice
+var idempotentMethods = []string{"GET", "HEAD", "OPTIONS", "PUT", "DELETE"}
+
+// HttpClient is shared by every request FoxBot makes, so they all get the configured proxy, certificates and
+// per-host settings
+type HttpClient struct {
+	client          *http.Client
+	userAgent       string
+	hosts           map[string]types.HttpHost
+	retries         int
+	retryDelay      time.Duration
+	maxRetryDelay   time.Duration
+	maxResponseSize int64
+}
+
+var httpClient atomic.Pointer[HttpClient]
+
+func init() {
+	httpClient.Store(NewHttpClient(types.Http{}, nil))
+}
+
+// SetHttpClient replaces the shared client, once the config has been loaded. It returns the previous client.
+func SetHttpClient(client *HttpClient) *HttpClient {
+	return httpClient.Swap(client)
+}
+
+// NewHttpTransport is the standard transport with the configured proxy and certificates
+func NewHttpTransport(config types.Http) http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if config.Proxy != nil {
+		transport.Proxy = http.ProxyURL(config.Proxy)
+	}
+
+	if config.RootCAs != nil {
+		transport.TLSClientConfig = &tls.Config{RootCAs: config.RootCAs, MinVersion: tls.VersionTLS12}
+	}
+
+	return transport
+}
+
+// NewHttpClient builds a client from the config's http section, anything not set uses the defaults.
+// The transport can be swapped, such as to replay fixtures, otherwise a nil transport uses NewHttpTransport.
+func NewHttpClient(config types.Http, transport http.RoundTripper) *HttpClient {
+	if transport == nil {
+		transport = NewHttpTransport(config)
+	}
+
+	c := &HttpClient{
+		client:          &http.Client{Transport: transport, Timeout: defaultHttpTimeout},
+		userAgent:       defaultUserAgent,
+		hosts:           config.Hosts,
+		retries:         defaultHttpRetries,
+		retryDelay:      defaultRetryDelay,
+		maxRetryDelay:   defaultMaxRetryDelay,
+		maxResponseSize: defaultMaxResponseSize,
+	}
+
+	if config.Timeout > 0 {
+		c.client.Timeout = config.Timeout
+	}
+
+	if len(config.UserAgent) > 0 {
+		c.userAgent = config.UserAgent
+	}
+
+	if config.Retries != nil {
+		c.retries = *config.Retries
+	}
+
+	if config.RetryDelay > 0 {
+		c.retryDelay = config.RetryDelay
+	}
+
+	if config.MaxRetryDelay > 0 {
+		c.maxRetryDelay = config.MaxRetryDelay
+	}
+
+	if config.MaxResponseSize > 0 {
+		c.maxResponseSize = config.MaxResponseSize
+	}
+
+	return c
+}
+
 func HttpRequest(method, url string, headers map[string]string, body io.Reader) *http.Response {
-	client := &http.Client{
-		Timeout: time.Second * 30,
+	return HttpRequestWithContext(context.Background(), method, url, headers, body)
+}
+
+// HttpRequestWithContext gives up, including between retries, as soon as the context is cancelled
+func HttpRequestWithContext(ctx context.Context, method, url string, headers map[string]string, body io.Reader) *http.Response {
+	return httpClient.Load().Request(ctx, method, url, headers, body)
+}
+
+// HttpRequestOnce makes a single attempt with a custom timeout, for callers such as long polling that handle
+// their own retries
+func HttpRequestOnce(ctx context.Context, method, url string, headers map[string]string, body io.Reader, timeout time.Duration) (*http.Response, error) {
+	return httpClient.Load().Once(ctx, method, url, headers, body, timeout)
+}
+
+// Request retries after a network error or a 5xx response when the method is idempotent. Other methods are only
+// retried on a 502, 503 or 504, where the server did not get as far as handling them.
+// The last response is returned if every attempt fails, or nil if there wasn't one.
+func (c *HttpClient) Request(ctx context.Context, method, url string, headers map[string]string, body io.Reader) *http.Response {
+	// Held in memory so it can be sent again
+	var payload []byte
+
+	if body != nil {
+		var err error
+		payload, err = io.ReadAll(body)
+
+		if err != nil {
+			log.Print(err)
+			return nil
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := c.newRequest(ctx, method, url, headers, payload)
+
+		if err != nil {
+			log.Print(err)
+			return nil
+		}
+
+		response, err := c.do(c.client, req)
+
+		if ctx.Err() != nil {
+			if response != nil {
+				_ = response.Body.Close()
+			}
+
+			return nil
+		}
+
+		if attempt >= c.retries || !retryable(method, response, err) {
+			return response
+		}
+
+		if response != nil {
+			_ = response.Body.Close()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(c.backoff(attempt)):
+		}
+	}
+}
+
+// Once makes a single attempt with the given timeout
+func (c *HttpClient) Once(ctx context.Context, method, url string, headers map[string]string, body io.Reader, timeout time.Duration) (*http.Response, error) {
+	var payload []byte
+
+	if body != nil {
+		var err error
+		payload, err = io.ReadAll(body)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	req, err := c.newRequest(ctx, method, url, headers, payload)
+
+	if err != nil {
+		return nil, err
+	}
+
+	client := *c.client
+	client.Timeout = timeout
+
+	return c.do(&client, req)
+}
+
+func (c *HttpClient) newRequest(ctx context.Context, method, url string, headers map[string]string, payload []byte) (*http.Request, error) {
+	var body io.Reader
+
+	if payload != nil {
+		body = bytes.NewReader(payload)
 	}
 
-	req, err := http.NewRequest(method, url, body)
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
 
 	if err != nil {
-		log.Print(err)
-		return nil
+		return nil, err
 	}
 
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:124.0) Gecko/20100101 Firefox/124.0")
+	req.Header.Set("User-Agent", c.userAgent)
 
-	if headers != nil {
-		for k, v := range headers {
+	// Hostnames are case insensitive, and the config's keys are lowercase
+	host, found := c.hosts[strings.ToLower(req.URL.Hostname())]
+
+	if found {
+		if len(host.UserAgent) > 0 {
+			req.Header.Set("User-Agent", host.UserAgent)
+		}
+
+		for k, v := range host.Headers {
 			req.Header.Set(k, v)
 		}
-	}
 
-	// Try 5 times then bail out
-	for i := 1; i <= 5; i++ {
-		response := makeRequest(client, req)
+		for name, value := range host.Cookies {
+			req.AddCookie(&http.Cookie{Name: name, Value: value})
+		}
 
-		if response != nil {
-			return response
+		if len(host.Username) > 0 {
+			req.SetBasicAuth(host.Username, host.Password)
 		}
+	}
 
-		time.Sleep(time.Second * 5 * time.Duration(i))
+	// The caller's headers are what the API needs, so they win over the config
+	for k, v := range headers {
+		req.Header.Set(k, v)
 	}
 
-	return nil
+	return req, nil
 }
 
-func makeRequest(client *http.Client, req *http.Request) *http.Response {
+func (c *HttpClient) do(client *http.Client, req *http.Request) (*http.Response, error) {
 	response, err := client.Do(req) //#nosec G704 -- URLs are from user config
 
 	if err != nil {
-		return nil
+		return nil, err
+	}
+
+	// Reading past the cap fails rather than filling the memory of a small device
+	response.Body = http.MaxBytesReader(nil, response.Body, c.maxResponseSize)
+
+	return response, nil
+}
+
+func retryable(method string, response *http.Response, err error) bool {
+	if err != nil {
+		return slices.Contains(idempotentMethods, method) && !errors.Is(err, context.Canceled)
+	}
+
+	if response.StatusCode < http.StatusInternalServerError {
+		return false
+	}
+
+	if slices.Contains(idempotentMethods, method) {
+		return true
+	}
+
+	return response.StatusCode == http.StatusBadGateway || response.StatusCode == http.StatusServiceUnavailable || response.StatusCode == http.StatusGatewayTimeout
+}
+
+// backoff doubles the delay with each attempt, randomised so that retries from many tasks don't line up
+func (c *HttpClient) backoff(attempt int) time.Duration {
+	delay := c.retryDelay << attempt
+
+	if delay <= 0 || delay > c.maxRetryDelay {
+		delay = c.maxRetryDelay
 	}
 
-	return response
+	return delay/2 + rand.N(delay/2+1)
 }
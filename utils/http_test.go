@@ -0,0 +1,160 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testHttpClient(config types.Http) *HttpClient {
+	config.RetryDelay = time.Millisecond
+	config.MaxRetryDelay = time.Millisecond
+
+	return NewHttpClient(config, nil)
+}
+
+func TestHttpClientRetries(t *testing.T) {
+	var attempts atomic.Int32
+	status := http.StatusInternalServerError
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		assert.Equal(t, r.Method == "POST", string(body) == "hello")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	retries := 2
+	client := testHttpClient(types.Http{Retries: &retries})
+
+	cases := []struct {
+		method   string
+		status   int
+		attempts int32
+	}{
+		{"GET", http.StatusInternalServerError, 3},
+		{"GET", http.StatusNotFound, 1},
+		// The server may have acted on it, so a POST is not sent twice
+		{"POST", http.StatusInternalServerError, 1},
+		// It never reached the server
+		{"POST", http.StatusServiceUnavailable, 3},
+	}
+
+	for _, c := range cases {
+		attempts.Store(0)
+		status = c.status
+
+		var body io.Reader
+
+		if c.method == "POST" {
+			body = strings.NewReader("hello")
+		}
+
+		response := client.Request(t.Context(), c.method, server.URL, nil, body)
+
+		if assert.NotNil(t, response) {
+			assert.Equal(t, c.status, response.StatusCode)
+			_ = response.Body.Close()
+		}
+
+		assert.Equal(t, c.attempts, attempts.Load(), "%s %d", c.method, c.status)
+	}
+}
+
+func TestHttpClientDoesNotRetryWhenCancelled(t *testing.T) {
+	var attempts atomic.Int32
+	ctx, cancel := context.WithCancel(t.Context())
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts.Add(1)
+		cancel()
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	assert.Nil(t, testHttpClient(types.Http{}).Request(ctx, "GET", server.URL, nil, nil))
+	assert.Equal(t, int32(1), attempts.Load())
+}
+
+func TestHttpClientHostSettings(t *testing.T) {
+	var request *http.Request
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request = r
+	}))
+	defer server.Close()
+
+	client := testHttpClient(types.Http{
+		UserAgent: "FoxBot",
+		Hosts: map[string]types.HttpHost{
+			"127.0.0.1": {
+				UserAgent: "FoxBot/local",
+				Headers:   map[string]string{"X-Token": "secret", "Accept": "text/html"},
+				Cookies:   map[string]string{"session": "abc"},
+				Username:  "fox",
+				Password:  "bot",
+			},
+		},
+	})
+
+	response := client.Request(t.Context(), "GET", server.URL, map[string]string{"Accept": "application/json"}, nil)
+	assert.NotNil(t, response)
+	_ = response.Body.Close()
+
+	assert.Equal(t, "FoxBot/local", request.UserAgent())
+	assert.Equal(t, "secret", request.Header.Get("X-Token"))
+	// The caller's headers win
+	assert.Equal(t, "application/json", request.Header.Get("Accept"))
+
+	cookie, err := request.Cookie("session")
+	assert.NoError(t, err)
+	assert.Equal(t, "abc", cookie.Value)
+
+	username, password, ok := request.BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "fox", username)
+	assert.Equal(t, "bot", password)
+
+	// Other hosts only get the client's user agent
+	response = client.Request(t.Context(), "GET", strings.Replace(server.URL, "127.0.0.1", "localhost", 1), nil, nil)
+	assert.NotNil(t, response)
+	_ = response.Body.Close()
+
+	assert.Equal(t, "FoxBot", request.UserAgent())
+	assert.Empty(t, request.Header.Get("X-Token"))
+}
+
+func TestHttpClientHostSettingsIgnoreCase(t *testing.T) {
+	client := testHttpClient(types.Http{
+		Hosts: map[string]types.HttpHost{"example.com": {Headers: map[string]string{"X-Token": "secret"}}},
+	})
+
+	req, err := client.newRequest(t.Context(), "GET", "https://Example.COM/feed.xml", nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", req.Header.Get("X-Token"))
+}
+
+func TestHttpClientCapsResponseSize(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer server.Close()
+
+	response := testHttpClient(types.Http{MaxResponseSize: 10}).Request(t.Context(), "GET", server.URL, nil, nil)
+	assert.NotNil(t, response)
+	defer response.Body.Close()
+
+	_, err := io.ReadAll(response.Body)
+
+	var tooLarge *http.MaxBytesError
+	assert.ErrorAs(t, err, &tooLarge)
+}
@@ -0,0 +1,124 @@
+package utils
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Pool bounds how many fetches run at once, both overall and against any one host
+type Pool struct {
+	workers chan struct{}
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	slots chan struct{}
+	// How many fetches hold or are waiting for a slot, so idle hosts can be forgotten
+	users int
+}
+
+func NewPool(workers, perHost int) *Pool {
+	return &Pool{
+		workers: make(chan struct{}, workers),
+		perHost: perHost,
+		hosts:   map[string]*hostSlots{},
+	}
+}
+
+// Go waits for a free worker then runs fn on it, tracked by wg.
+// It returns the context's error without running fn if the context is cancelled first.
+func (p *Pool) Go(ctx context.Context, wg *sync.WaitGroup, fn func()) error {
+	select {
+	case p.workers <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	wg.Go(func() {
+		defer func() { <-p.workers }()
+		fn()
+	})
+
+	return nil
+}
+
+// HttpRequest is HttpRequestWithContext once the URL's host has a free slot. The slot is held until the body is closed.
+func (p *Pool) HttpRequest(ctx context.Context, method, rawURL string, headers map[string]string, body io.Reader) *http.Response {
+	host := rawURL
+
+	if parsed, err := url.Parse(rawURL); err == nil {
+		host = parsed.Host
+	}
+
+	release, err := p.acquireHost(ctx, host)
+
+	if err != nil {
+		return nil
+	}
+
+	response := HttpRequestWithContext(ctx, method, rawURL, headers, body)
+
+	if response == nil {
+		release()
+		return nil
+	}
+
+	response.Body = &releasingBody{ReadCloser: response.Body, release: sync.OnceFunc(release)}
+
+	return response
+}
+
+func (p *Pool) acquireHost(ctx context.Context, host string) (func(), error) {
+	p.mu.Lock()
+	h, found := p.hosts[host]
+
+	if !found {
+		h = &hostSlots{slots: make(chan struct{}, p.perHost)}
+		p.hosts[host] = h
+	}
+
+	h.users++
+	p.mu.Unlock()
+
+	done := func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		h.users--
+
+		if h.users == 0 {
+			delete(p.hosts, host)
+		}
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		done()
+		return nil, ctx.Err()
+	}
+
+	return func() {
+		<-h.slots
+		done()
+	}, nil
+}
+
+// releasingBody frees the host slot when the response body is closed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+
+	return err
+}
@@ -0,0 +1,102 @@
+package utils
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// maxTracker records the most calls in flight at once
+type maxTracker struct {
+	current atomic.Int32
+	max     atomic.Int32
+}
+
+func (m *maxTracker) enter() {
+	n := m.current.Add(1)
+
+	for {
+		seen := m.max.Load()
+
+		if n <= seen || m.max.CompareAndSwap(seen, n) {
+			return
+		}
+	}
+}
+
+func (m *maxTracker) leave() {
+	m.current.Add(-1)
+}
+
+func TestPoolLimitsWorkers(t *testing.T) {
+	pool := NewPool(3, 1)
+	var tracker maxTracker
+	var wg sync.WaitGroup
+
+	for range 20 {
+		assert.NoError(t, pool.Go(t.Context(), &wg, func() {
+			tracker.enter()
+			defer tracker.leave()
+
+			time.Sleep(5 * time.Millisecond)
+		}))
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(3), tracker.max.Load())
+}
+
+func TestPoolStopsWhenCancelled(t *testing.T) {
+	pool := NewPool(1, 1)
+	var wg sync.WaitGroup
+	release := make(chan struct{})
+
+	assert.NoError(t, pool.Go(t.Context(), &wg, func() { <-release }))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	ran := false
+	assert.ErrorIs(t, pool.Go(ctx, &wg, func() { ran = true }), context.Canceled)
+
+	close(release)
+	wg.Wait()
+	assert.False(t, ran)
+}
+
+func TestPoolLimitsRequestsPerHost(t *testing.T) {
+	var tracker maxTracker
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tracker.enter()
+		defer tracker.leave()
+
+		time.Sleep(5 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	pool := NewPool(10, 2)
+	var wg sync.WaitGroup
+
+	for range 10 {
+		assert.NoError(t, pool.Go(t.Context(), &wg, func() {
+			response := pool.HttpRequest(t.Context(), "GET", server.URL, nil, nil)
+
+			if assert.NotNil(t, response) {
+				assert.NoError(t, response.Body.Close())
+			}
+		}))
+	}
+
+	wg.Wait()
+	assert.Equal(t, int32(2), tracker.max.Load())
+
+	// Idle hosts are forgotten
+	assert.Empty(t, pool.hosts)
+}
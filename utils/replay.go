@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/antfie/FoxBot/types"
+)
+
+// Long names are cut short and made unique with a hash of the URL
+const maxFixtureNameLength = 100
+
+var unsafeFixtureCharacters = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// Secrets that can be part of a URL are replaced with this, so they are not written to fixture names
+const redactedFixtureSecret = "REDACTED"
+
+var (
+	// Telegram puts the bot token in the path, as /bot123456:ABC-DEF/sendMessage
+	telegramBotToken = regexp.MustCompile(`^bot\d+:[A-Za-z0-9_-]+$`)
+
+	secretQueryParameters = []string{"access_token", "api_key", "apikey", "appid", "key", "password", "secret", "sig", "signature", "token"}
+)
+
+// FixturePath is where the response to a request is kept, such as feeds.example.com/GET_news_rss.xml.http.
+// Fixtures are raw HTTP responses, so they can be written by hand as well as recorded. Tokens in the URL are
+// redacted, so the same fixture is used whatever the token.
+func FixturePath(dir string, req *http.Request) string {
+	requestURI := redactedRequestURI(req.URL)
+	target := strings.TrimPrefix(requestURI, "/")
+	name := req.Method + "_" + strings.Trim(unsafeFixtureCharacters.ReplaceAllString(target, "_"), "_")
+
+	if len(name) > maxFixtureNameLength {
+		hash := sha256.Sum256([]byte(req.URL.Scheme + "://" + req.URL.Host + requestURI))
+		name = name[:maxFixtureNameLength] + "_" + hex.EncodeToString(hash[:4])
+	}
+
+	host := unsafeFixtureCharacters.ReplaceAllString(req.URL.Host, "_")
+
+	return filepath.Join(dir, host, name+".http")
+}
+
+// redactedRequestURI is the path and query with any tokens replaced: Telegram's bot token, the token of a Discord
+// webhook and query parameters such as key or access_token
+func redactedRequestURI(u *url.URL) string {
+	segments := strings.Split(u.EscapedPath(), "/")
+
+	for i, segment := range segments {
+		switch {
+		case telegramBotToken.MatchString(segment):
+			segments[i] = "bot" + redactedFixtureSecret
+		case i >= 2 && segments[i-2] == "webhooks":
+			segments[i] = redactedFixtureSecret
+		}
+	}
+
+	result := strings.Join(segments, "/")
+
+	if len(u.RawQuery) == 0 {
+		return result
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+
+	if err != nil {
+		return result + "?" + redactedFixtureSecret
+	}
+
+	redacted := false
+
+	for name := range query {
+		if slices.Contains(secretQueryParameters, strings.ToLower(name)) {
+			query.Set(name, redactedFixtureSecret)
+			redacted = true
+		}
+	}
+
+	// Left as it was unless something was redacted, as encoding sorts the parameters
+	if !redacted {
+		return result + "?" + u.RawQuery
+	}
+
+	return result + "?" + query.Encode()
+}
+
+// ReplayTransport answers requests from the fixtures in a directory rather than the network
+type ReplayTransport struct {
+	dir string
+}
+
+func NewReplayTransport(dir string) *ReplayTransport {
+	return &ReplayTransport{dir: dir}
+}
+
+func (t *ReplayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	path := FixturePath(t.dir, req)
+	fixture, err := os.ReadFile(path) //#nosec G304 -- path is built from the fixtures directory
+
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for %s %s: %w", req.Method, req.URL, err)
+	}
+
+	response, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(fixture)), req)
+
+	if err != nil {
+		return nil, fmt.Errorf("could not read fixture %s: %w", path, err)
+	}
+
+	return response, nil
+}
+
+// RecordTransport makes requests as normal and saves each response as a fixture for ReplayTransport
+type RecordTransport struct {
+	dir  string
+	next http.RoundTripper
+}
+
+func NewRecordTransport(dir string, next http.RoundTripper) *RecordTransport {
+	return &RecordTransport{dir: dir, next: next}
+}
+
+func (t *RecordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	response, err := t.next.RoundTrip(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fixture, err := httputil.DumpResponse(response, true)
+
+	if err != nil {
+		_ = response.Body.Close()
+		return nil, err
+	}
+
+	path := FixturePath(t.dir, req)
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err == nil {
+		err = os.WriteFile(path, fixture, 0600)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("could not record fixture %s: %w", path, err)
+	}
+
+	// The body was read by the dump, so the saved copy is returned
+	return http.ReadResponse(bufio.NewReader(bytes.NewReader(fixture)), req)
+}
+
+// NewReplayClient serves every request from the fixtures in a directory. A missing fixture fails straight away
+// rather than being retried.
+func NewReplayClient(config types.Http, dir string) *HttpClient {
+	noRetries := 0
+	config.Retries = &noRetries
+
+	return NewHttpClient(config, NewReplayTransport(dir))
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/antfie/FoxBot/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixturePath(t *testing.T) {
+	req, _ := http.NewRequest("GET", "https://feeds.example.com/news/rss.xml?edition=uk", nil)
+	assert.Equal(t, filepath.Join("fixtures", "feeds.example.com", "GET_news_rss.xml_edition_uk.http"), FixturePath("fixtures", req))
+
+	req, _ = http.NewRequest("GET", "https://example.com/"+strings.Repeat("a", 200), nil)
+	name := filepath.Base(FixturePath("fixtures", req))
+	assert.Len(t, name, maxFixtureNameLength+len("_12345678.http"))
+}
+
+func TestFixturePathRedactsSecrets(t *testing.T) {
+	cases := map[string]string{
+		"https://api.telegram.org/bot123456:ABC-def_789/sendMessage":         "POST_botREDACTED_sendMessage.http",
+		"https://discord.com/api/webhooks/1234/s3cr3t-t0ken":                 "POST_api_webhooks_1234_REDACTED.http",
+		"https://api.example.com/weather?q=London&appid=abc123&units=metric": "POST_weather_appid_REDACTED_q_London_units_metric.http",
+		"https://example.com/news?edition=uk&page=2":                         "POST_news_edition_uk_page_2.http",
+	}
+
+	for target, expected := range cases {
+		req, _ := http.NewRequest("POST", target, nil)
+		path := FixturePath("fixtures", req)
+
+		assert.Equal(t, expected, filepath.Base(path))
+		assert.NotContains(t, path, "ABC-def")
+	}
+
+	// A long name is made unique without the secret, so replaying with another token finds the same fixture
+	first, _ := http.NewRequest("GET", "https://example.com/"+strings.Repeat("a", 200)+"?token=one", nil)
+	second, _ := http.NewRequest("GET", "https://example.com/"+strings.Repeat("a", 200)+"?token=two", nil)
+	assert.Equal(t, FixturePath("fixtures", first), FixturePath("fixtures", second))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("<rss>" + r.URL.Path + "</rss>"))
+	}))
+
+	recorder := NewHttpClient(types.Http{}, NewRecordTransport(dir, http.DefaultTransport))
+	response := recorder.Request(t.Context(), "GET", server.URL+"/feed.xml", nil, nil)
+	assert.NotNil(t, response)
+
+	body, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "<rss>/feed.xml</rss>", string(body))
+	_ = response.Body.Close()
+
+	// The network is no longer needed
+	server.Close()
+
+	replayer := NewReplayClient(types.Http{}, dir)
+	response = replayer.Request(t.Context(), "GET", server.URL+"/feed.xml", nil, nil)
+	assert.NotNil(t, response)
+
+	body, err = io.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "<rss>/feed.xml</rss>", string(body))
+	assert.Equal(t, `"v1"`, response.Header.Get("ETag"))
+	_ = response.Body.Close()
+
+	assert.Nil(t, replayer.Request(t.Context(), "GET", server.URL+"/missing.xml", nil, nil))
+}
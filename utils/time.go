@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/antfie/FoxBot/types"
 	"log"
+	"slices"
 	"strings"
 	"time"
 )
@@ -57,21 +58,39 @@ func ParseRSSTimestampFromString(d string) time.Time {
 	return value
 }
 
-func ParseDurationFromString(d string) time.Duration {
-	if strings.ToLower(d) == "hourly" {
-		return time.Hour
+// ParseFrequencyFromString accepts hourly, half_hourly, daily, a duration such as 15m or 6h,
+// or a cron expression such as "30 7 * * 1-5"
+func ParseFrequencyFromString(f string) types.Frequency {
+	if interval, ok := parseInterval(f); ok {
+		return types.Frequency{Interval: interval}
 	}
 
-	if strings.ToLower(d) == "half_hourly" {
-		return time.Minute * 30
+	schedule, err := ParseCron(f)
+
+	if err != nil {
+		log.Panicf("Invalid frequency %q, expected hourly, half_hourly, daily, a duration such as 15m or a cron expression: %v", f, err)
+	}
+
+	return types.Frequency{Cron: schedule}
+}
+
+func parseInterval(d string) (time.Duration, bool) {
+	switch strings.ToLower(d) {
+	case "hourly":
+		return time.Hour, true
+	case "half_hourly":
+		return time.Minute * 30, true
+	case "daily":
+		return time.Hour * 24, true
 	}
 
-	if strings.ToLower(d) == "daily" {
-		return time.Hour * 24
+	value, err := time.ParseDuration(d)
+
+	if err != nil || value <= 0 {
+		return 0, false
 	}
 
-	log.Panic("Invalid duration")
-	return time.Hour
+	return value, true
 }
 
 func FormatHumanReadableDuration(start, end time.Time) string {
@@ -192,26 +211,41 @@ func daysInMonth(year int, month time.Month) int {
 	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
 }
 
+// IsWithinDuration reports whether now falls in any of the duration's windows, in its timezone if it has one
 func IsWithinDuration(now time.Time, duration types.TimeDuration) bool {
-	if now.Hour() < duration.From.Hour() {
-		return false
+	if duration.Location != nil {
+		now = now.In(duration.Location)
 	}
 
-	if now.Hour() == duration.From.Hour() {
-		if now.Minute() < duration.From.Minute() {
-			return false
+	for _, window := range duration.Windows {
+		if isWithinWindow(now, window) {
+			return true
 		}
 	}
 
-	if now.Hour() == duration.To.Hour() {
-		if now.Minute() > duration.To.Minute() {
+	return false
+}
+
+func isWithinWindow(now time.Time, window types.TimeWindow) bool {
+	minute := now.Hour()*60 + now.Minute()
+	from := window.From.Hour()*60 + window.From.Minute()
+	to := window.To.Hour()*60 + window.To.Minute()
+	day := now.Weekday()
+
+	if from <= to {
+		if minute < from || minute > to {
+			return false
+		}
+	} else {
+		if minute < from && minute > to {
 			return false
 		}
-	}
 
-	if now.Hour() > duration.To.Hour() {
-		return false
+		// The early hours of an overnight window belong to the day before, when it opened
+		if minute <= to {
+			day = (day + 6) % 7
+		}
 	}
 
-	return true
+	return len(window.Days) == 0 || slices.Contains(window.Days, day)
 }
@@ -64,20 +64,30 @@ func TestParseDateFromString(t *testing.T) {
 	assert.Equal(t, 2024, result.Year())
 }
 
-func TestParseDurationFromString(t *testing.T) {
-	assert.Equal(t, time.Hour, ParseDurationFromString("hourly"))
-	assert.Equal(t, time.Hour, ParseDurationFromString("Hourly"))
-	assert.Equal(t, 30*time.Minute, ParseDurationFromString("half_hourly"))
-	assert.Equal(t, 30*time.Minute, ParseDurationFromString("Half_Hourly"))
-	assert.Equal(t, 24*time.Hour, ParseDurationFromString("daily"))
-	assert.Equal(t, 24*time.Hour, ParseDurationFromString("Daily"))
+func TestParseFrequencyFromString(t *testing.T) {
+	assert.Equal(t, time.Hour, ParseFrequencyFromString("hourly").Interval)
+	assert.Equal(t, time.Hour, ParseFrequencyFromString("Hourly").Interval)
+	assert.Equal(t, 30*time.Minute, ParseFrequencyFromString("half_hourly").Interval)
+	assert.Equal(t, 30*time.Minute, ParseFrequencyFromString("Half_Hourly").Interval)
+	assert.Equal(t, 24*time.Hour, ParseFrequencyFromString("daily").Interval)
+	assert.Equal(t, 24*time.Hour, ParseFrequencyFromString("Daily").Interval)
+	assert.Equal(t, 15*time.Minute, ParseFrequencyFromString("15m").Interval)
+	assert.Equal(t, 6*time.Hour, ParseFrequencyFromString("6h").Interval)
+	assert.Equal(t, 90*time.Minute, ParseFrequencyFromString("1h30m").Interval)
+
+	frequency := ParseFrequencyFromString("30 7 * * 1-5")
+	assert.Zero(t, frequency.Interval)
+	assert.Equal(t, "30 7 * * 1-5", frequency.Cron.Expression)
+
+	assert.Panics(t, func() { ParseFrequencyFromString("-1h") })
+	assert.Panics(t, func() { ParseFrequencyFromString("weekly") })
 }
 
 func TestIsWithinDuration(t *testing.T) {
-	duration := types.TimeDuration{
+	duration := types.TimeDuration{Windows: []types.TimeWindow{{
 		From: ParseTimeFromString("08:00"),
 		To:   ParseTimeFromString("17:00"),
-	}
+	}}}
 
 	// Within range
 	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
@@ -108,6 +118,60 @@ func TestIsWithinDuration(t *testing.T) {
 	assert.False(t, IsWithinDuration(now, duration))
 }
 
+func TestIsWithinDurationOvernight(t *testing.T) {
+	duration := types.TimeDuration{Windows: []types.TimeWindow{{
+		From: ParseTimeFromString("22:00"),
+		To:   ParseTimeFromString("06:00"),
+	}}}
+
+	assert.True(t, IsWithinDuration(time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), duration))
+	assert.True(t, IsWithinDuration(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), duration))
+	assert.True(t, IsWithinDuration(time.Date(2024, 1, 1, 6, 0, 0, 0, time.UTC), duration))
+	assert.False(t, IsWithinDuration(time.Date(2024, 1, 1, 6, 1, 0, 0, time.UTC), duration))
+	assert.False(t, IsWithinDuration(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), duration))
+	assert.False(t, IsWithinDuration(time.Date(2024, 1, 1, 21, 59, 0, 0, time.UTC), duration))
+}
+
+func TestIsWithinDurationDays(t *testing.T) {
+	duration := types.TimeDuration{Windows: []types.TimeWindow{
+		{
+			From: ParseTimeFromString("08:00"),
+			To:   ParseTimeFromString("17:00"),
+			Days: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+		},
+		{
+			// Friday night only, running into Saturday morning
+			From: ParseTimeFromString("22:00"),
+			To:   ParseTimeFromString("02:00"),
+			Days: []time.Weekday{time.Friday},
+		},
+	}}
+
+	// 1 January 2024 was a Monday
+	assert.True(t, IsWithinDuration(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), duration))
+	assert.False(t, IsWithinDuration(time.Date(2024, 1, 6, 12, 0, 0, 0, time.UTC), duration))
+	assert.True(t, IsWithinDuration(time.Date(2024, 1, 5, 23, 0, 0, 0, time.UTC), duration))
+	assert.True(t, IsWithinDuration(time.Date(2024, 1, 6, 1, 0, 0, 0, time.UTC), duration))
+	assert.False(t, IsWithinDuration(time.Date(2024, 1, 5, 1, 0, 0, 0, time.UTC), duration))
+	assert.False(t, IsWithinDuration(time.Date(2024, 1, 6, 23, 0, 0, 0, time.UTC), duration))
+}
+
+func TestIsWithinDurationTimezone(t *testing.T) {
+	location := time.FixedZone("UTC+10", 10*60*60)
+
+	duration := types.TimeDuration{
+		Windows: []types.TimeWindow{{
+			From: ParseTimeFromString("08:00"),
+			To:   ParseTimeFromString("17:00"),
+		}},
+		Location: location,
+	}
+
+	// 23:00 UTC is 09:00 the next day in UTC+10
+	assert.True(t, IsWithinDuration(time.Date(2024, 1, 1, 23, 0, 0, 0, time.UTC), duration))
+	assert.False(t, IsWithinDuration(time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), duration))
+}
+
 func TestShuffleStringArray(t *testing.T) {
 	original := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
 	shuffled := make([]string, len(original))
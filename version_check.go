@@ -1,27 +1,23 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/antfie/FoxBot/utils"
 	"io"
 	"net/http"
+	"time"
 
 	"github.com/fatih/color"
 )
 
+// Startup doesn't wait long for GitHub
+const versionCheckTimeout = 10 * time.Second
+
 func checkForUpdates() {
-	client := &http.Client{}
 	url := "https://github.com/antfie/FoxBot/releases/latest"
-	req, err := http.NewRequest("GET", url, nil)
-
-	if err != nil {
-		return
-	}
-
-	req.Header.Add("Accept", "application/json")
-
-	resp, err := client.Do(req) //#nosec G704 -- URL is hardcoded
+	resp, err := utils.HttpRequestOnce(context.Background(), "GET", url, map[string]string{"Accept": "application/json"}, nil, versionCheckTimeout)
 
 	if err != nil {
 		return